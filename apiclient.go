@@ -0,0 +1,244 @@
+package goappimage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// MaxRateLimitWait is how long a request to a release API waits for an exhausted rate limit to reset.
+// If the reset is further away, a *RateLimitError is returned instead.
+var MaxRateLimitWait = time.Minute
+
+// Requests are not retried more often than this, in case a server keeps resetting its rate limit into the past
+const maxRateLimitAttempts = 3
+
+// RateLimitError is returned when the rate limit of a release API is exhausted
+type RateLimitError struct {
+	URL   string
+	Reset time.Time
+}
+
+func (e *RateLimitError) Error() string {
+	return "rate limit exceeded for " + e.URL + " until " + e.Reset.Format(time.RFC3339)
+}
+
+// APICache keeps responses of the release APIs on disk, so that they can be revalidated with
+// conditional requests, which do not count against the rate limit of GitHub, and used while rate limited
+type APICache struct {
+	Dir string
+}
+
+// DefaultAPICache is the cache used by DefaultGitHubClient and for GitLab, nil disables caching
+var DefaultAPICache = &APICache{Dir: filepath.Join(xdg.CacheHome, "goappimage", "api")}
+
+type apiCacheEntry struct {
+	ETag         string
+	LastModified string
+	Body         []byte
+}
+
+// path returns where the response for u is cached. The token is part of the key,
+// so that responses for one token are never served for another.
+func (c *APICache) path(u string, token string) string {
+	h := sha256.Sum256([]byte(u + "\x00" + token))
+	return filepath.Join(c.Dir, hex.EncodeToString(h[:])+".json")
+}
+
+func (c *APICache) get(u string, token string) (*apiCacheEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+	data, err := ioutil.ReadFile(c.path(u, token))
+	if err != nil {
+		return nil, false
+	}
+	var entry apiCacheEntry
+	if json.Unmarshal(data, &entry) != nil {
+		return nil, false
+	}
+	return &entry, true
+}
+
+func (c *APICache) put(u string, token string, entry apiCacheEntry) error {
+	if c == nil {
+		return nil
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(c.Dir, 0700)
+	if err != nil {
+		return err
+	}
+	p := c.path(u, token)
+	err = ioutil.WriteFile(p+".tmp", data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(p+".tmp", p)
+}
+
+// apiRequest is a GET request to a release API
+type apiRequest struct {
+	Name       string // For error messages, e.g., "GitHub API"
+	URL        string
+	Header     http.Header
+	Token      string // Already set in Header, used to separate cached responses
+	HTTPClient *http.Client
+	Cache      *APICache
+}
+
+// getJSON does the request and decodes the JSON response into v.
+// Cached responses are revalidated with If-None-Match or If-Modified-Since.
+// If the rate limit is exhausted, the request is retried once it resets, as long as that is within MaxRateLimitWait.
+// Otherwise the cached response is used even though it may be stale, and a *RateLimitError returned if there is none.
+func (r apiRequest) getJSON(v interface{}) error {
+	client := r.HTTPClient
+	if client == nil {
+		client = http.DefaultClient
+	}
+	cached, ok := r.Cache.get(r.URL, r.Token)
+	for attempt := 1; ; attempt++ {
+		req, err := http.NewRequest(http.MethodGet, r.URL, nil)
+		if err != nil {
+			return err
+		}
+		for k, values := range r.Header {
+			req.Header[k] = values
+		}
+		if ok {
+			if cached.ETag != "" {
+				req.Header.Set("If-None-Match", cached.ETag)
+			} else if cached.LastModified != "" {
+				req.Header.Set("If-Modified-Since", cached.LastModified)
+			}
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		if reset, limited := rateLimitReset(resp); limited {
+			resp.Body.Close()
+			wait := time.Until(reset) + time.Second
+			if wait <= MaxRateLimitWait && attempt < maxRateLimitAttempts {
+				time.Sleep(wait)
+				continue
+			}
+			if ok {
+				return json.Unmarshal(cached.Body, v)
+			}
+			return &RateLimitError{URL: r.URL, Reset: reset}
+		}
+		defer resp.Body.Close()
+		switch resp.StatusCode {
+		case http.StatusNotModified:
+			if ok {
+				return json.Unmarshal(cached.Body, v)
+			}
+			return fmt.Errorf("%s: %s: %s without a cached response", r.Name, r.URL, resp.Status)
+		case http.StatusOK:
+		default:
+			return fmt.Errorf("%s: %s: %s", r.Name, r.URL, resp.Status)
+		}
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(body, v)
+		if err != nil {
+			return err
+		}
+		entry := apiCacheEntry{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified"), Body: body}
+		if entry.ETag != "" || entry.LastModified != "" {
+			// A cache that cannot be written only costs requests
+			r.Cache.put(r.URL, r.Token, entry)
+		}
+		return nil
+	}
+}
+
+// assetTransport sends the credentials of a release API with the requests for the assets of a release,
+// which private projects need. Requests for a URL in rewrite go to the API URL of the asset it maps to instead,
+// and get header, as do requests to host if it is set. Everything else, including the redirects to where
+// the assets are actually stored, is sent as it is, so the credentials never leave the API host.
+type assetTransport struct {
+	base    http.RoundTripper
+	host    string
+	rewrite map[string]string
+	header  http.Header
+}
+
+func (t *assetTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	apiURL, rewrite := t.rewrite[req.URL.String()]
+	if !rewrite && (t.host == "" || req.URL.Host != t.host) {
+		return t.base.RoundTrip(req)
+	}
+	req = req.Clone(req.Context())
+	if rewrite {
+		u, err := url.Parse(apiURL)
+		if err != nil {
+			return nil, err
+		}
+		req.URL = u
+		req.Host = ""
+	}
+	for k, values := range t.header {
+		req.Header[k] = values
+	}
+	return t.base.RoundTrip(req)
+}
+
+// withAssetTransport returns a copy of client that does its requests through t
+func withAssetTransport(client *http.Client, t *assetTransport) *http.Client {
+	if client == nil {
+		client = http.DefaultClient
+	}
+	c := *client
+	t.base = c.Transport
+	if t.base == nil {
+		t.base = http.DefaultTransport
+	}
+	c.Transport = t
+	return &c
+}
+
+// rateLimitReset tells whether resp says that the rate limit is exhausted, and when it resets.
+// GitHub answers 403 or 429 with X-RateLimit-* headers or Retry-After, GitLab 429 with RateLimit-* headers.
+func rateLimitReset(resp *http.Response) (time.Time, bool) {
+	if resp.StatusCode != http.StatusForbidden && resp.StatusCode != http.StatusTooManyRequests {
+		return time.Time{}, false
+	}
+	if s := resp.Header.Get("Retry-After"); s != "" {
+		if secs, err := strconv.Atoi(s); err == nil {
+			return time.Now().Add(time.Duration(secs) * time.Second), true
+		}
+		if t, err := http.ParseTime(s); err == nil {
+			return t, true
+		}
+	}
+	exhausted := resp.StatusCode == http.StatusTooManyRequests
+	for _, prefix := range []string{"X-RateLimit-", "RateLimit-"} {
+		if resp.Header.Get(prefix+"Remaining") == "0" {
+			exhausted = true
+		}
+		if reset, err := strconv.ParseInt(resp.Header.Get(prefix+"Reset"), 10, 64); err == nil && exhausted {
+			return time.Unix(reset, 0), true
+		}
+	}
+	if exhausted {
+		return time.Now().Add(time.Minute), true
+	}
+	return time.Time{}, false
+}
@@ -5,6 +5,7 @@ import (
 	"bytes"
 	"crypto/md5"
 	"encoding/hex"
+	"errors"
 	"io/ioutil"
 	"net/url"
 
@@ -14,7 +15,6 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strconv"
 	"strings"
 	"time"
 
@@ -22,10 +22,10 @@ import (
 	"github.com/adrg/xdg"
 	"go.lsp.dev/uri"
 )
-import "io"
 
 // AppImage handles AppImage files.
 // Currently it is using using a static build of mksquashfs/unsquashfs
+// (and dwarfsextract for AppImages with a DwarFS payload)
 // but eventually may be rewritten to do things natively in Go
 type AppImage struct {
 	Path              string
@@ -37,11 +37,19 @@ type AppImage struct {
 	ThumbnailFilename string
 	ThumbnailFilepath string
 	Offset            int64
+	PayloadFormat     string
 	RawContents       string
-	UpdateInformation string
+	UpdateInformation UpdateInformation
 	NiceName          string
 }
 
+// Filesystem image formats that can be in an AppImage
+const (
+	PayloadSquashfs = helpers.PayloadSquashfs
+	PayloadDwarfs   = helpers.PayloadDwarfs
+	PayloadISO9660  = helpers.PayloadISO9660
+)
+
 var thumbnailsDirNormal = xdg.CacheHome + "/thumbnails/normal/"
 
 const execLocationKey = helpers.ExecLocationKey
@@ -66,6 +74,12 @@ func NewAppImage(path string) AppImage {
 		ai.ImageType = -1
 		return ai
 	}
+	return openAppImage(path)
+}
+
+// openAppImage does the work of NewAppImage for files of any name
+func openAppImage(path string) AppImage {
+	ai := AppImage{Path: path, ImageType: 0}
 	ai.URI = strings.TrimSpace(string(uri.File(filepath.Clean(ai.Path))))
 	ai.Md5 = ai.calculateMD5filenamepart() // Need this also for non-existing AppImages for removal
 	ai.DesktopFilename = "appimagekit_" + ai.Md5 + ".desktop"
@@ -81,12 +95,29 @@ func NewAppImage(path string) AppImage {
 	if ai.ImageType < 1 {
 		return ai
 	}
+	if ai.ImageType == 1 {
+		ai.PayloadFormat = PayloadISO9660
+	}
 	if ai.ImageType > 1 {
-		ai.Offset = helpers.CalculateElfSize(ai.Path)
+		offset, err := ai.FindPayloadOffset()
+		if err != nil {
+			helpers.PrintError("appimage: "+ai.Path, err)
+			ai.ImageType = -1
+			return ai
+		}
+		ai.Offset = offset
+		ai.PayloadFormat = ai.determinePayloadFormat()
+	}
+	// Files that are still being downloaded or copied may have any name
+	err := ai.CheckComplete()
+	if errors.Is(err, ErrTruncated) {
+		helpers.PrintError("appimage", err)
+		ai.ImageType = -1
+		return ai
 	}
 	ui, err := ai.ReadUpdateInformation()
 	if err == nil && ui != "" {
-		ai.UpdateInformation = ui
+		ai.UpdateInformation = parseEmbeddedUpdateInformation(ui)
 	}
 	// ai.discoverContents() // Only do when really needed since this is slow
 	// log.Println("XXXXXXXXXXXXXXXXXXXXXXXXXXXXXX rawcontents:", ai.rawcontents)
@@ -95,6 +126,22 @@ func NewAppImage(path string) AppImage {
 	return ai
 }
 
+// FindPayloadOffset returns the offset at which the filesystem image starts in a type-2 AppImage.
+// The offset is validated by the probes of the registered payload formats, and an error is returned
+// if no filesystem image can be found after the runtime.
+func (ai AppImage) FindPayloadOffset() (int64, error) {
+	return helpers.FindPayloadOffset(ai.Path, payloadProbes())
+}
+
+func (ai AppImage) determinePayloadFormat() string {
+	f, err := os.Open(ai.Path)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	return helpers.PayloadFormatAt(f, ai.Offset, payloadProbes())
+}
+
 // DiscoverContents Fills rawcontents with the raw output of our extraction tools,
 // libarchive and unsquashfs. This is a slow operation and should hence only be done
 // once we are sure that we really need this information.
@@ -104,20 +151,13 @@ func NewAppImage(path string) AppImage {
 func (ai AppImage) DiscoverContents(verbose bool) {
 	// Let's get the listing of files inside the AppImage. We can work on this later on
 	// to resolve symlinks, and to determine which files to extract in addition to the desktop file and icon
-	cmd := exec.Command("")
-	if ai.ImageType == 1 {
-		cmd = exec.Command("bsdtar", "-t", ai.Path)
-	} else if ai.ImageType == 2 {
-		cmd = exec.Command("unsquashfs", "-f", "-n", "-ll", "-o", strconv.FormatInt(ai.Offset, 10), "-d ''", ai.Path)
-	}
-	if verbose == true {
-		log.Printf("cmd: %q\n", cmd.String())
+	payload, err := ai.OpenPayload(verbose)
+	if err != nil {
+		helpers.PrintError("appimage: DiscoverContents: "+ai.Path, err)
+		return
 	}
-	var out bytes.Buffer
-	cmd.Stdout = &out
-	// err := cmd.Run()
-	cmd.Run()
-	ai.RawContents = out.String()
+	defer payload.Close()
+	ai.RawContents, _ = payload.List()
 }
 
 func (ai AppImage) calculateMD5filenamepart() string {
@@ -138,7 +178,7 @@ func (ai AppImage) calculateNiceName() string {
 	return niceName
 }
 
-func runCommand(cmd *exec.Cmd, verbose bool) (io.Writer, error) {
+func runCommand(cmd *exec.Cmd, verbose bool) (*bytes.Buffer, error) {
 	if verbose == true {
 		log.Printf("runCommand: %q\n", cmd)
 	}
@@ -147,7 +187,7 @@ func runCommand(cmd *exec.Cmd, verbose bool) (io.Writer, error) {
 	err := cmd.Run()
 	// printError("runCommand", err)
 	// log.Println(cmd.Stdout)
-	return cmd.Stdout, err
+	return &out, err
 }
 
 // Check whether we have an AppImage at all.
@@ -203,24 +243,6 @@ func (ai AppImage) determineImageType() int {
 // 	// printError("appimage", err) // Do not print error since AppImages on read-only media are common
 // }
 
-// Validate checks the quality of an AppImage and sends desktop notification, returns error or nil
-// TODO: Add more checks and reuse this in appimagetool
-// func (ai AppImage) Validate(verbose bool) error {
-// 	if verbose == true {
-// 		log.Println("Validating AppImage", ai.Path)
-// 	}
-// 	// Check validity of the updateinformation in this AppImage, if it contains some
-// 	if ai.UpdateInformation != "" {
-// 		log.Println("Validating updateinformation in", ai.Path)
-// 		err := helpers.ValidateUpdateInformation(ai.UpdateInformation)
-// 		if err != nil {
-// 			helpers.PrintError("appimage: updateinformation verification", err)
-// 			return err
-// 		}
-// 	}
-// 	return nil
-// }
-
 // func ioReader(file string) io.ReaderAt {
 // 	r, err := os.Open(file)
 // 	defer r.Close()
@@ -234,34 +256,63 @@ func (ai AppImage) determineImageType() int {
 // TODO: resolve symlinks
 // TODO: Should this be a io.Reader()?
 func (ai AppImage) ExtractFile(filepath string, destinationdirpath string, verbose bool) error {
-	var err error
-	if ai.ImageType == 1 {
-		err = os.MkdirAll(destinationdirpath, os.ModePerm)
-		cmd := exec.Command("bsdtar", "-C", destinationdirpath, "-xf", ai.Path, filepath)
-		_, err = runCommand(cmd, verbose)
-		return err
-	} else if ai.ImageType == 2 {
-		cmd := exec.Command("unsquashfs", "-f", "-n", "-o", strconv.FormatInt(ai.Offset, 10), "-d", destinationdirpath, ai.Path, filepath)
-		_, err = runCommand(cmd, verbose)
+	payload, err := ai.OpenPayload(verbose)
+	if err != nil {
 		return err
 	}
+	defer payload.Close()
 	// FIXME: What we may have extracted may well be (until here) broken symlinks... we need to do better than that
-	return nil
+	return payload.Extract(filepath, destinationdirpath)
 }
 
 // ReadUpdateInformation reads updateinformation from an AppImage
 // Returns updateinformation string and error
 func (ai AppImage) ReadUpdateInformation() (string, error) {
-	aibytes, err := helpers.GetSectionData(ai.Path, ".upd_info")
-	ui := strings.TrimSpace(string(bytes.Trim(aibytes, "\x00")))
+	sections, err := ai.ReadSections()
 	if err != nil {
 		return "", err
 	}
+	ui := strings.TrimSpace(string(bytes.Trim(sections[".upd_info"].Data, "\x00")))
 	// Don't validate here, we don't want to get warnings all the time.
 	// We have AppImage.Validate as its own function which we call less frequently than this.
 	return ui, nil
 }
 
+// WriteUpdateInformation validates ui and writes it into the .upd_info section in place,
+// zero-padded to the size reserved by the runtime.
+// A legacy MD5 digest is recalculated. The SHA-256 digest covers the update information, too,
+// so an existing signature no longer matches; this is reported by signatureInvalidated
+// and the AppImage needs to be signed again.
+func (ai AppImage) WriteUpdateInformation(ui UpdateInformation) (signatureInvalidated bool, err error) {
+	err = ui.Validate()
+	if err != nil {
+		return false, err
+	}
+	sections, err := ai.ReadSections()
+	if err != nil {
+		return false, err
+	}
+	section, ok := sections[".upd_info"]
+	if !ok {
+		return false, errors.New(ai.Path + " has no .upd_info section")
+	}
+	err = ai.writeSection(section, []byte(ui.String()))
+	if err != nil {
+		return false, err
+	}
+	if md5Section, ok := sections[".digest_md5"]; ok && len(bytes.Trim(md5Section.Data, "\x00")) > 0 {
+		sum, err := ai.MD5Digest()
+		if err != nil {
+			return false, err
+		}
+		err = ai.writeSection(md5Section, sum)
+		if err != nil {
+			return false, err
+		}
+	}
+	return len(bytes.Trim(sections[".sha256_sig"].Data, "\x00")) > 0, nil
+}
+
 // LaunchMostRecentAppImage launches an the most recent application for a given
 // updateinformation that we found among the integrated AppImages.
 // Kinda like poor man's Launch Services. Probably we should make as much use of it as possible.
@@ -333,19 +384,16 @@ func FindAppImagesWithMatchingUpdateInformation(updateinformation string) []stri
 // getFSTime reads FSTime from the AppImage. We are doing this only when it is needed,
 // not when an NewAppImage is called
 func (ai AppImage) getFSTime() time.Time {
-	if ai.ImageType == 2 {
-		result, err := exec.Command("unsquashfs", "-q", "-fstime", "-o", strconv.FormatInt(ai.Offset, 10), ai.Path).Output()
-		resstr := strings.TrimSpace(string(bytes.TrimSpace(result)))
-		if err != nil {
-			helpers.PrintError("appimage: getFSTime: "+ai.Path, err)
-			return time.Unix(0, 0)
-		}
-		if n, err := strconv.Atoi(resstr); err == nil {
-			return time.Unix(int64(n), 0)
-		}
-		log.Println("appimage: getFSTime:", resstr, "is not an integer.")
+	payload, err := ai.OpenPayload(false)
+	if err != nil {
+		helpers.PrintError("appimage: getFSTime: "+ai.Path, err)
+		return time.Unix(0, 0)
+	}
+	defer payload.Close()
+	metadata, err := payload.Metadata()
+	if err != nil {
+		helpers.PrintError("appimage: getFSTime: "+ai.Path, err)
 		return time.Unix(0, 0)
 	}
-	log.Println("TODO: Implement getFSTime for type-1 AppImages")
-	return time.Unix(0, 0)
+	return metadata.FSTime
 }
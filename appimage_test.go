@@ -0,0 +1,100 @@
+package goappimage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+// writeUpdatableAppImage writes an AppImage with update information in a .upd_info section of 1024 bytes,
+// as the runtime reserves, a legacy MD5 digest and the sections for signing
+func writeUpdatableAppImage(t *testing.T) AppImage {
+	t.Helper()
+	path, _ := writeTestELF(t, []testSection{
+		{name: ".upd_info", data: append([]byte("zsync|https://old.example.com/App.AppImage.zsync"), make([]byte, 976)...)},
+		{name: ".digest_md5", data: bytes.Repeat([]byte{1}, 16)},
+		{name: ".sha256_sig", data: make([]byte, 1024)},
+		{name: ".sig_key", data: make([]byte, 8192)},
+	}, testSquashfs(128<<10))
+	ai := openAppImage(path)
+	if ai.UpdateInformation.String() != "zsync|https://old.example.com/App.AppImage.zsync" {
+		t.Fatalf("%s has update information %q", path, ai.UpdateInformation)
+	}
+	return ai
+}
+
+func TestWriteUpdateInformation(t *testing.T) {
+	ai := writeUpdatableAppImage(t)
+	ui, err := ParseUpdateInformation("gh-releases-zsync|owner|repo|latest|App-*-x86_64.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidated, err := ai.WriteUpdateInformation(ui)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if invalidated {
+		t.Error("the signature of an unsigned AppImage was invalidated")
+	}
+	sections, err := ai.ReadSections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := append([]byte(ui.String()), make([]byte, 1024-len(ui.String()))...)
+	if !bytes.Equal(sections[".upd_info"].Data, want) {
+		t.Errorf(".upd_info is not the update information padded with zero bytes: %q", sections[".upd_info"].Data)
+	}
+	if got := openAppImage(ai.Path).UpdateInformation; got.String() != ui.String() {
+		t.Errorf("reopened with update information %q", got)
+	}
+	if ok, err := ai.VerifyMD5Digest(); err != nil || !ok {
+		t.Errorf("the MD5 digest was not updated: %v, %v", ok, err)
+	}
+}
+
+func TestWriteUpdateInformationRejects(t *testing.T) {
+	ai := writeUpdatableAppImage(t)
+	before, err := ioutil.ReadFile(ai.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tooLong := UpdateInformation{Transport: "zsync", Fields: []string{"https://example.com/" + strings.Repeat("a", 1000) + ".zsync"}}
+	if tooLong.Validate() != nil {
+		t.Fatal("the update information is expected to be valid")
+	}
+	for _, ui := range []UpdateInformation{
+		tooLong,
+		{Transport: "zsync", Fields: []string{"example.com/App.AppImage.zsync"}},
+		{Transport: "unknown", Fields: []string{"a"}},
+	} {
+		if _, err := ai.WriteUpdateInformation(ui); err == nil {
+			t.Errorf("%q: expected an error", ui)
+		}
+	}
+	if after, err := ioutil.ReadFile(ai.Path); err != nil || !bytes.Equal(after, before) {
+		t.Errorf("the AppImage was changed: %v", err)
+	}
+}
+
+func TestWriteUpdateInformationInvalidatesTheSignature(t *testing.T) {
+	ai := writeUpdatableAppImage(t)
+	if err := ai.Sign(newTestEntity(t, "signer")); err != nil {
+		t.Fatal(err)
+	}
+	ui, err := ParseUpdateInformation("zsync|https://new.example.com/App.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	invalidated, err := ai.WriteUpdateInformation(ui)
+	if err != nil || !invalidated {
+		t.Errorf("the signature was not reported as invalidated: %v, %v", invalidated, err)
+	}
+	res, err := ai.VerifySignature(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Signed || res.Valid {
+		t.Errorf("the old signature is expected to be invalid: %+v", res)
+	}
+}
@@ -0,0 +1,157 @@
+package goappimage
+
+import (
+	"encoding/xml"
+	"errors"
+	"path"
+	"strings"
+	"time"
+)
+
+// Directories in which AppStream metadata is looked for, the latter being the legacy location
+var appStreamDirs = []string{"usr/share/metainfo", "usr/share/appdata"}
+
+// ErrNoAppStream is returned for AppImages that do not contain AppStream metadata
+var ErrNoAppStream = errors.New("AppImage contains no AppStream metadata")
+
+// AppStream holds the parts of the AppStream metadata of an AppImage we are interested in,
+// https://www.freedesktop.org/software/appstream/docs/chap-Metadata.html
+type AppStream struct {
+	Path     string             `xml:"-"` // Location of the metadata inside the AppImage
+	ID       string             `xml:"id"`
+	Releases []AppStreamRelease `xml:"releases>release"`
+}
+
+// AppStreamRelease is a <release> of the AppStream metadata, newest first by convention
+type AppStreamRelease struct {
+	Version      string                 `xml:"version,attr"`
+	Date         string                 `xml:"date,attr"`
+	Timestamp    int64                  `xml:"timestamp,attr"`
+	Descriptions []appStreamDescription `xml:"description"`
+}
+
+type appStreamDescription struct {
+	Lang     string `xml:"http://www.w3.org/XML/1998/namespace lang,attr"`
+	InnerXML string `xml:",innerxml"`
+}
+
+// Time returns when the release was made, the zero time if unknown
+func (r AppStreamRelease) Time() time.Time {
+	if r.Timestamp > 0 {
+		return time.Unix(r.Timestamp, 0).UTC()
+	}
+	for _, layout := range []string{"2006-01-02", time.RFC3339} {
+		if t, err := time.Parse(layout, r.Date); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Description returns the untranslated description of the release as plain text,
+// paragraphs separated by empty lines and list items starting with "- "
+func (r AppStreamRelease) Description() string {
+	for _, d := range r.Descriptions {
+		if d.Lang == "" {
+			return appStreamText(d.InnerXML)
+		}
+	}
+	return ""
+}
+
+// appStreamText converts the markup of an AppStream description to plain text.
+// Translated paragraphs and list items, as used by older metadata, are left out.
+func appStreamText(markup string) string {
+	dec := xml.NewDecoder(strings.NewReader("<description>" + markup + "</description>"))
+	var blocks []string
+	var current strings.Builder
+	skip := 0
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if skip > 0 || hasLangAttr(t) {
+				skip++
+				continue
+			}
+			if t.Name.Local == "li" {
+				current.WriteString("- ")
+			}
+		case xml.EndElement:
+			if skip > 0 {
+				skip--
+				continue
+			}
+			switch t.Name.Local {
+			case "p", "li":
+				blocks = append(blocks, strings.Join(strings.Fields(current.String()), " "))
+				current.Reset()
+			}
+			// Items of a list belong together, paragraphs and lists are separated by empty lines
+			switch t.Name.Local {
+			case "p", "ul", "ol":
+				blocks = append(blocks, "")
+			}
+		case xml.CharData:
+			if skip == 0 {
+				current.Write(t)
+			}
+		}
+	}
+	text := strings.Join(blocks, "\n")
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.Replace(text, "\n\n\n", "\n\n", -1)
+	}
+	return strings.TrimSpace(text)
+}
+
+func hasLangAttr(e xml.StartElement) bool {
+	for _, a := range e.Attr {
+		if a.Name.Local == "lang" {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadAppStream reads the AppStream metadata from inside the AppImage.
+// Returns ErrNoAppStream if there is none.
+func (ai AppImage) ReadAppStream(verbose bool) (*AppStream, error) {
+	payload, err := ai.OpenPayload(verbose)
+	if err != nil {
+		return nil, err
+	}
+	defer payload.Close()
+	return readAppStream(payload)
+}
+
+// readAppStream reads the AppStream metadata from an already opened payload
+func readAppStream(payload PayloadReader) (*AppStream, error) {
+	for _, dir := range appStreamDirs {
+		infos, err := payload.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			if !strings.HasSuffix(info.Name(), ".xml") {
+				continue
+			}
+			r, err := payload.Open(path.Join(dir, info.Name()))
+			if err != nil {
+				return nil, err
+			}
+			as := &AppStream{Path: path.Join(dir, info.Name())}
+			err = xml.NewDecoder(r).Decode(as)
+			r.Close()
+			if err != nil {
+				return nil, err
+			}
+			as.ID = strings.TrimSpace(as.ID)
+			return as, nil
+		}
+	}
+	return nil, ErrNoAppStream
+}
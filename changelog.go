@@ -0,0 +1,174 @@
+package goappimage
+
+import (
+	"os"
+	"strings"
+	"time"
+)
+
+// Where ChangelogEntries come from
+const (
+	ChangelogGitHub         = "github"
+	ChangelogAppStream      = "appstream"       // Of the new version
+	ChangelogLocalAppStream = "local-appstream" // Of the installed version
+)
+
+// ChangelogEntry is what changed in one version
+type ChangelogEntry struct {
+	Version     string
+	Date        time.Time // Zero if unknown
+	Description string    // Plain text, or Markdown for GitHub releases
+	Source      string
+}
+
+// Headline returns the first non-empty line of the description
+func (e ChangelogEntry) Headline() string {
+	for _, line := range strings.Split(e.Description, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "#*- "))
+		if line != "" {
+			return line
+		}
+	}
+	return ""
+}
+
+// Changelog returns what changed between the installed version of the AppImage and the available one,
+// one entry per version, newest first. The first of these sources that has entries is used:
+//   - the bodies of the GitHub releases for gh-releases-* update information
+//   - the AppStream releases of update, the new version, if it is available locally, e.g., downloaded by
+//     Update or found by FindOfflineUpdate. If update is nil, a complete download in the .part file is used.
+//     Without either, the AppStream releases are read from the new version the update information points to.
+//     Only the parts of it that are needed are downloaded, using range requests, which works for squashfs
+//     payloads on servers that support them.
+//   - the AppStream releases of the installed AppImage, which only knows about newer versions if its
+//     X-AppImage-Version lags behind
+//
+// The installed version is the X-AppImage-Version, or the newest AppStream release of the installed AppImage.
+// If it is unknown, all entries are returned.
+func (ai AppImage) Changelog(update *AppImage) ([]ChangelogEntry, error) {
+	local, installed, localErr := ai.readChangelogMetadata()
+	if installed == "" && local != nil && len(local.Releases) > 0 {
+		installed = local.Releases[0].Version
+	}
+
+	var firstErr error
+	if ai.UpdateInformation.isGitHubReleases() {
+		entries, err := ai.UpdateInformation.gitHubChangelog(DefaultGitHubClient, installed)
+		if len(entries) > 0 {
+			return entries, nil
+		}
+		firstErr = err
+	}
+
+	if _, err := os.Stat(ai.Path + PartialSuffix); update == nil && err == nil {
+		part := openAppImage(ai.Path + PartialSuffix)
+		if part.ImageType > 0 && part.CheckComplete() == nil {
+			update = &part
+		}
+	}
+	if update != nil || !ai.UpdateInformation.IsZero() {
+		var remote *AppStream
+		var err error
+		if update != nil {
+			remote, err = update.ReadAppStream(false)
+		} else {
+			remote, err = ai.UpdateInformation.readRemoteAppStream()
+		}
+		if err == nil {
+			if entries := appStreamChangelog(remote, installed, ChangelogAppStream); len(entries) > 0 {
+				return entries, nil
+			}
+		} else if firstErr == nil && err != ErrNoAppStream {
+			firstErr = err
+		}
+	}
+
+	if local != nil {
+		if entries := appStreamChangelog(local, installed, ChangelogLocalAppStream); len(entries) > 0 {
+			return entries, nil
+		}
+	} else if firstErr == nil && localErr != ErrNoAppStream {
+		firstErr = localErr
+	}
+	return nil, firstErr
+}
+
+// readChangelogMetadata reads the AppStream metadata and X-AppImage-Version, opening the payload only once
+func (ai AppImage) readChangelogMetadata() (*AppStream, string, error) {
+	payload, err := ai.OpenPayload(false)
+	if err != nil {
+		return nil, "", err
+	}
+	defer payload.Close()
+	version, _ := readVersion(payload)
+	as, err := readAppStream(payload)
+	return as, version, err
+}
+
+// newerVersion returns true if version is newer than installed, or if installed is unknown
+func newerVersion(version string, installed string) bool {
+	return installed == "" || CompareVersions(version, installed) > 0
+}
+
+func appStreamChangelog(as *AppStream, installed string, source string) []ChangelogEntry {
+	var entries []ChangelogEntry
+	for _, r := range as.Releases {
+		if r.Version == "" || !newerVersion(r.Version, installed) {
+			continue
+		}
+		entries = append(entries, ChangelogEntry{
+			Version:     r.Version,
+			Date:        r.Time(),
+			Description: r.Description(),
+			Source:      source,
+		})
+	}
+	return entries
+}
+
+// gitHubChangelog returns the releases newer than installed up to the one the update information points to.
+// For a fixed release name such as "continuous", that release is all there is.
+func (ui UpdateInformation) gitHubChangelog(c *GitHubClient, installed string) ([]ChangelogEntry, error) {
+	if ui.ReleaseName() != "latest" {
+		release, err := c.Release(ui.Username(), ui.Repository(), ui.ReleaseName())
+		if err != nil {
+			return nil, err
+		}
+		return []ChangelogEntry{gitHubChangelogEntry(release)}, nil
+	}
+	latest, err := c.Release(ui.Username(), ui.Repository(), "latest")
+	if err != nil {
+		return nil, err
+	}
+	// Older releases are of no interest once one that is not newer than the installed version shows up
+	releases, err := c.releasesWhile(ui.Username(), ui.Repository(), func(page []GitHubRelease) bool {
+		for _, r := range page {
+			if !r.Draft && !newerVersion(r.TagName, installed) {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil && len(releases) == 0 {
+		return []ChangelogEntry{gitHubChangelogEntry(latest)}, nil
+	}
+	var entries []ChangelogEntry
+	for i := range releases {
+		r := &releases[i]
+		// Like "latest", pre-releases are not considered
+		if r.Draft || r.Prerelease || CompareVersions(r.TagName, latest.TagName) > 0 || !newerVersion(r.TagName, installed) {
+			continue
+		}
+		entries = append(entries, gitHubChangelogEntry(r))
+	}
+	return entries, nil
+}
+
+func gitHubChangelogEntry(r *GitHubRelease) ChangelogEntry {
+	return ChangelogEntry{
+		Version:     strings.TrimPrefix(r.TagName, "v"),
+		Date:        r.PublishedAt,
+		Description: strings.TrimSpace(strings.Replace(r.Body, "\r\n", "\n", -1)),
+		Source:      ChangelogGitHub,
+	}
+}
@@ -0,0 +1,399 @@
+package goappimage
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/ini.v1"
+)
+
+// Native validation of desktop files against the desktop entry specification, like desktop-file-validate does,
+// https://specifications.freedesktop.org/desktop-entry-spec/latest/
+
+// Keys of [Desktop Entry] groups by their value type
+var (
+	desktopBooleanKeys = []string{"NoDisplay", "Hidden", "DBusActivatable", "Terminal", "StartupNotify", "PrefersNonDefaultGPU", "SingleMainWindow"}
+	desktopStringKeys  = []string{"Type", "Version", "TryExec", "Exec", "Path", "StartupWMClass", "URL"}
+	desktopLocaleKeys  = []string{"Name", "GenericName", "Comment", "Icon", "Keywords"}
+	desktopListKeys    = []string{"OnlyShowIn", "NotShowIn", "Actions", "MimeType", "Categories", "Implements", "Keywords"}
+)
+
+var desktopTypes = []string{"Application", "Link", "Directory"}
+
+var desktopVersions = []string{"1.0", "1.1", "1.2", "1.3", "1.4", "1.5"}
+
+// https://specifications.freedesktop.org/menu-spec/latest/apa.html
+var desktopMainCategories = []string{
+	"AudioVideo", "Audio", "Video", "Development", "Education", "Game", "Graphics",
+	"Network", "Office", "Science", "Settings", "System", "Utility",
+}
+
+// https://specifications.freedesktop.org/menu-spec/latest/apas02.html
+var desktopAdditionalCategories = []string{
+	"Building", "Debugger", "IDE", "GUIDesigner", "Profiling", "RevisionControl", "Translation",
+	"Calendar", "ContactManagement", "Database", "Dictionary", "Chart", "Email", "Finance",
+	"FlowChart", "PDA", "ProjectManagement", "Presentation", "Spreadsheet", "WordProcessor",
+	"2DGraphics", "VectorGraphics", "RasterGraphics", "3DGraphics", "Scanning", "OCR",
+	"Photography", "Publishing", "Viewer", "TextTools", "DesktopSettings", "HardwareSettings",
+	"Printing", "PackageManager", "Dialup", "InstantMessaging", "Chat", "IRCClient", "Feed",
+	"FileTransfer", "HamRadio", "News", "P2P", "RemoteAccess", "Telephony", "TelephonyTools",
+	"VideoConference", "WebBrowser", "WebDevelopment", "Midi", "Mixer", "Sequencer", "Tuner",
+	"TV", "AudioVideoEditing", "Player", "Recorder", "DiscBurning", "ActionGame",
+	"AdventureGame", "ArcadeGame", "BoardGame", "BlocksGame", "CardGame", "KidsGame",
+	"LogicGame", "RolePlaying", "Shooter", "Simulation", "SportsGame", "StrategyGame", "Art",
+	"Construction", "Music", "Languages", "ArtificialIntelligence", "Astronomy", "Biology",
+	"Chemistry", "ComputerScience", "DataVisualization", "Economy", "Electricity", "Geography",
+	"Geology", "Geoscience", "History", "Humanities", "ImageProcessing", "Literature", "Maps",
+	"Math", "NumericalAnalysis", "MedicalSoftware", "Physics", "Robotics", "Spirituality",
+	"Sports", "ParallelComputing", "Amusement", "Archiving", "Compression", "Electronics",
+	"Emulator", "Engineering", "FileTools", "FileManager", "TerminalEmulator", "Filesystem",
+	"Monitor", "Security", "Accessibility", "Calculator", "Clock", "TextEditor",
+	"Documentation", "Adult", "Core", "KDE", "GNOME", "XFCE", "DDE", "GTK", "Qt", "Motif",
+	"Java", "ConsoleOnly",
+}
+
+var (
+	desktopGroupLine = regexp.MustCompile(`^\[([^\[\]]+)\]$`)
+	desktopKeyLine   = regexp.MustCompile(`^([A-Za-z0-9-]+)(?:\[([^\]]*)\])?\s*=\s*(.*)$`)
+	desktopLocale    = regexp.MustCompile(`^[a-z]{2,3}(_[A-Z]{2})?(\.[A-Za-z0-9-]+)?(@[A-Za-z0-9]+)?$`)
+)
+
+type desktopEntry struct {
+	line   int
+	locale string
+	value  string
+}
+
+type desktopGroup struct {
+	name    string
+	line    int
+	entries map[string][]desktopEntry // Keyed by key without locale, in the order they appear
+}
+
+func (g *desktopGroup) value(key string) (string, bool) {
+	for _, e := range g.entries[key] {
+		if e.locale == "" {
+			return e.value, true
+		}
+	}
+	return "", false
+}
+
+func containsString(list []string, s string) bool {
+	for _, l := range list {
+		if l == s {
+			return true
+		}
+	}
+	return false
+}
+
+// ValidateDesktopFile validates the contents of a desktop file against the desktop entry specification.
+// The findings are reported with the CheckDesktopFile check ID.
+func ValidateDesktopFile(data []byte) ValidationReport {
+	var report ValidationReport
+	errorf := func(line int, format string, a ...interface{}) {
+		report.addError(CheckDesktopFile, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, a...))
+	}
+	warnf := func(line int, format string, a ...interface{}) {
+		report.addWarning(CheckDesktopFile, fmt.Sprintf("line %d: ", line)+fmt.Sprintf(format, a...))
+	}
+
+	var groups []*desktopGroup
+	var group *desktopGroup
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; scanner.Scan(); n++ {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if m := desktopGroupLine.FindStringSubmatch(line); m != nil {
+			for _, g := range groups {
+				if g.name == m[1] {
+					errorf(n, "duplicate group [%s]", m[1])
+				}
+			}
+			group = &desktopGroup{name: m[1], line: n, entries: make(map[string][]desktopEntry)}
+			groups = append(groups, group)
+			continue
+		}
+		m := desktopKeyLine.FindStringSubmatch(line)
+		if m == nil {
+			errorf(n, "invalid line %q", line)
+			continue
+		}
+		if group == nil {
+			errorf(n, "key %s is not in a group", m[1])
+			continue
+		}
+		if m[2] != "" && !desktopLocale.MatchString(m[2]) {
+			errorf(n, "invalid locale %q in key %s", m[2], m[1])
+		}
+		for _, e := range group.entries[m[1]] {
+			if e.locale == m[2] {
+				errorf(n, "duplicate key %s in group [%s]", line[:strings.Index(line, "=")], group.name)
+			}
+		}
+		group.entries[m[1]] = append(group.entries[m[1]], desktopEntry{line: n, locale: m[2], value: m[3]})
+	}
+	if err := scanner.Err(); err != nil {
+		report.addError(CheckDesktopFile, err.Error())
+		return report
+	}
+	if len(groups) == 0 || groups[0].name != "Desktop Entry" {
+		errorf(1, "the first group must be [Desktop Entry]")
+		return report
+	}
+
+	entry := groups[0]
+	validateDesktopGroupValues(entry, errorf, warnf)
+
+	typ, ok := entry.value("Type")
+	if !ok {
+		errorf(entry.line, "required key Type is missing")
+	} else if !containsString(desktopTypes, typ) && !strings.HasPrefix(typ, "X-") {
+		errorf(entry.entries["Type"][0].line, "invalid Type %q", typ)
+	}
+	if _, ok := entry.value("Name"); !ok {
+		errorf(entry.line, "required key Name is missing")
+	}
+	dbus, _ := entry.value("DBusActivatable")
+	if _, ok := entry.value("Exec"); !ok && typ == "Application" && dbus != "true" {
+		errorf(entry.line, "required key Exec is missing for Type=Application")
+	}
+	if _, ok := entry.value("URL"); !ok && typ == "Link" {
+		errorf(entry.line, "required key URL is missing for Type=Link")
+	}
+	if version, ok := entry.value("Version"); ok && !containsString(desktopVersions, version) {
+		warnf(entry.entries["Version"][0].line, "unknown Version %q", version)
+	}
+	if _, ok := entry.value("OnlyShowIn"); ok {
+		if _, ok := entry.value("NotShowIn"); ok {
+			errorf(entry.line, "OnlyShowIn and NotShowIn must not both be present")
+		}
+	}
+	if exec, ok := entry.value("Exec"); ok {
+		validateExec(exec, entry.entries["Exec"][0].line, errorf, warnf)
+	}
+	if categories, ok := entry.value("Categories"); ok {
+		validateCategories(categories, entry.entries["Categories"][0].line, errorf, warnf)
+	}
+	validateActions(entry, groups[1:], errorf, warnf)
+
+	for _, g := range groups[1:] {
+		if !strings.HasPrefix(g.name, "Desktop Action ") && !strings.HasPrefix(g.name, "X-") {
+			errorf(g.line, "unknown group [%s]", g.name)
+		}
+	}
+	return report
+}
+
+// validateDesktopGroupValues checks that keys are known and that values have the right type
+func validateDesktopGroupValues(g *desktopGroup, errorf, warnf func(int, string, ...interface{})) {
+	keys := make([]string, 0, len(g.entries))
+	for key := range g.entries {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys) // Report in a stable order
+	for _, key := range keys {
+		entries := g.entries[key]
+		known := containsString(desktopBooleanKeys, key) || containsString(desktopStringKeys, key) ||
+			containsString(desktopLocaleKeys, key) || containsString(desktopListKeys, key)
+		if !known && !strings.HasPrefix(key, "X-") {
+			errorf(entries[0].line, "unknown key %s", key)
+			continue
+		}
+		for _, e := range entries {
+			if e.locale != "" && !containsString(desktopLocaleKeys, key) && !strings.HasPrefix(key, "X-") {
+				errorf(e.line, "key %s cannot be localized", key)
+			}
+			if containsString(desktopBooleanKeys, key) && e.value != "true" && e.value != "false" {
+				errorf(e.line, "value %q of boolean key %s must be true or false", e.value, key)
+			}
+			if containsString(desktopStringKeys, key) {
+				for _, r := range e.value {
+					if r > 127 || r < 32 {
+						errorf(e.line, "value of string key %s contains non-ASCII or control characters", key)
+						break
+					}
+				}
+			}
+			if containsString(desktopListKeys, key) && e.value != "" && !strings.HasSuffix(e.value, ";") {
+				warnf(e.line, "value of list key %s should end with a semicolon", key)
+			}
+			if err := checkDesktopEscapes(e.value); err != nil {
+				errorf(e.line, "value of key %s: %s", key, err)
+			}
+		}
+	}
+}
+
+// checkDesktopEscapes checks that only the escape sequences defined by the specification are used
+func checkDesktopEscapes(value string) error {
+	for i := 0; i < len(value); i++ {
+		if value[i] != '\\' {
+			continue
+		}
+		if i+1 >= len(value) {
+			return errors.New("value ends with a backslash")
+		}
+		if !strings.ContainsRune(`sntr\;`, rune(value[i+1])) {
+			return fmt.Errorf("invalid escape sequence \\%c", value[i+1])
+		}
+		i++
+	}
+	return nil
+}
+
+// validateExec checks the field codes in an Exec value
+func validateExec(exec string, line int, errorf, warnf func(int, string, ...interface{})) {
+	if strings.Count(exec, `"`)%2 != 0 {
+		errorf(line, "unbalanced quotes in Exec")
+	}
+	fileCodes := 0
+	for _, arg := range strings.Fields(exec) {
+		for i := 0; i < len(arg); i++ {
+			if arg[i] != '%' {
+				continue
+			}
+			if i+1 >= len(arg) {
+				errorf(line, "incomplete field code at the end of %q in Exec", arg)
+				break
+			}
+			code := arg[i+1]
+			i++
+			switch code {
+			case '%', 'i', 'c', 'k':
+			case 'f', 'u':
+				fileCodes++
+			case 'F', 'U':
+				fileCodes++
+				if arg != "%"+string(code) {
+					errorf(line, "field code %%%c must be an argument of its own in Exec", code)
+				}
+			case 'd', 'D', 'n', 'N', 'v', 'm':
+				warnf(line, "deprecated field code %%%c in Exec", code)
+			default:
+				errorf(line, "invalid field code %%%c in Exec", code)
+			}
+		}
+	}
+	if fileCodes > 1 {
+		errorf(line, "Exec must not contain more than one of %%f, %%F, %%u and %%U")
+	}
+}
+
+// validateCategories checks that all categories are registered or start with X-
+func validateCategories(categories string, line int, errorf, warnf func(int, string, ...interface{})) {
+	hasMain := false
+	for _, c := range strings.Split(categories, ";") {
+		switch {
+		case c == "" || strings.HasPrefix(c, "X-"):
+		case containsString(desktopMainCategories, c):
+			hasMain = true
+		case !containsString(desktopAdditionalCategories, c):
+			errorf(line, "unknown category %q", c)
+		}
+	}
+	if !hasMain {
+		warnf(line, "Categories should contain a main category like %s", strings.Join(desktopMainCategories, ", "))
+	}
+}
+
+// validateActions checks that Actions and the [Desktop Action] groups match up
+func validateActions(entry *desktopGroup, groups []*desktopGroup, errorf, warnf func(int, string, ...interface{})) {
+	actions, _ := entry.value("Actions")
+	listed := make(map[string]bool)
+	for _, a := range strings.Split(actions, ";") {
+		if a == "" {
+			continue
+		}
+		listed[a] = true
+		found := false
+		for _, g := range groups {
+			if g.name == "Desktop Action "+a {
+				found = true
+			}
+		}
+		if !found {
+			errorf(entry.entries["Actions"][0].line, "action %s has no [Desktop Action %s] group", a, a)
+		}
+	}
+	dbus, _ := entry.value("DBusActivatable")
+	for _, g := range groups {
+		if !strings.HasPrefix(g.name, "Desktop Action ") {
+			continue
+		}
+		id := strings.TrimPrefix(g.name, "Desktop Action ")
+		if !listed[id] {
+			warnf(g.line, "group [%s] is not listed in Actions", g.name)
+		}
+		if _, ok := g.value("Name"); !ok {
+			errorf(g.line, "required key Name is missing in group [%s]", g.name)
+		}
+		exec, ok := g.value("Exec")
+		if !ok && dbus != "true" {
+			errorf(g.line, "required key Exec is missing in group [%s]", g.name)
+		}
+		if ok {
+			validateExec(exec, g.entries["Exec"][0].line, errorf, warnf)
+		}
+		for key, entries := range g.entries {
+			if key != "Name" && key != "Icon" && key != "Exec" && !strings.HasPrefix(key, "X-") {
+				errorf(entries[0].line, "unknown key %s in group [%s]", key, g.name)
+			}
+		}
+	}
+}
+
+// WriteDesktopFile validates data and writes it to the DesktopFilepath of the AppImage.
+// Nothing is written if the validation finds errors, so that broken entries never reach the menus.
+func (ai AppImage) WriteDesktopFile(data []byte) (ValidationReport, error) {
+	report := ValidateDesktopFile(data)
+	report.Path = ai.DesktopFilepath
+	if !report.Valid() {
+		return report, errors.New("not writing invalid desktop file " + ai.DesktopFilepath + ": " + report.Errors[0].Message)
+	}
+	err := os.MkdirAll(filepath.Dir(ai.DesktopFilepath), os.ModePerm)
+	if err != nil {
+		return report, err
+	}
+	tmp := ai.DesktopFilepath + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0644)
+	if err != nil {
+		return report, err
+	}
+	return report, os.Rename(tmp, ai.DesktopFilepath)
+}
+
+// Version returns the X-AppImage-Version of the desktop file in the root of the AppImage,
+// "" if it has none
+func (ai AppImage) Version() (string, error) {
+	payload, err := ai.OpenPayload(false)
+	if err != nil {
+		return "", err
+	}
+	defer payload.Close()
+	return readVersion(payload)
+}
+
+// readVersion reads the X-AppImage-Version from an already opened payload
+func readVersion(payload PayloadReader) (string, error) {
+	_, data, err := findRootDesktopFile(payload)
+	if err != nil {
+		return "", err
+	}
+	cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, data) // Do not cripple lines hat contain ";"
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(cfg.Section("Desktop Entry").Key("X-AppImage-Version").String()), nil
+}
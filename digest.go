@@ -0,0 +1,109 @@
+package goappimage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"hash"
+	"io"
+	"os"
+)
+
+// ErrNoDigest is returned by VerifyMD5Digest for AppImages without a legacy .digest_md5 section
+var ErrNoDigest = errors.New("AppImage has no embedded MD5 digest")
+
+// Sections that are treated as zero bytes when calculating digests,
+// since they are filled in after the digest has been calculated
+var digestSkippedSections = []string{".digest_md5", ".sha256_sig", ".sig_key"}
+
+// Digest returns the SHA-256 digest of the AppImage as defined by the AppImage specification:
+// the whole file, with the contents of the .sha256_sig and .sig_key sections treated as zero bytes.
+// This is the digest that the embedded signature is made for (in its hex encoded form).
+func (ai AppImage) Digest() ([]byte, error) {
+	sections, err := ai.ReadSections()
+	if err != nil {
+		return nil, err
+	}
+	return ai.digest(sha256.New(), sections, ".sha256_sig", ".sig_key")
+}
+
+// MD5Digest returns the legacy MD5 digest of the AppImage: the whole file,
+// with the contents of the .digest_md5, .sha256_sig and .sig_key sections treated as zero bytes
+func (ai AppImage) MD5Digest() ([]byte, error) {
+	sections, err := ai.ReadSections()
+	if err != nil {
+		return nil, err
+	}
+	return ai.digest(md5.New(), sections, digestSkippedSections...)
+}
+
+// VerifyMD5Digest compares the legacy .digest_md5 section with the MD5 digest of the AppImage.
+// Returns ErrNoDigest if the AppImage has no (or an empty) .digest_md5 section.
+func (ai AppImage) VerifyMD5Digest() (bool, error) {
+	sections, err := ai.ReadSections()
+	if err != nil {
+		return false, err
+	}
+	embedded := bytes.Trim(sections[".digest_md5"].Data, "\x00")
+	if len(embedded) == 0 {
+		return false, ErrNoDigest
+	}
+	sum, err := ai.digest(md5.New(), sections, digestSkippedSections...)
+	if err != nil {
+		return false, err
+	}
+	// appimagetool embeds the raw digest, but accept a hex encoded one, too
+	data := sections[".digest_md5"].Data
+	if len(data) >= md5.Size && bytes.Equal(data[:md5.Size], sum) {
+		return true, nil
+	}
+	return string(bytes.TrimSpace(embedded)) == hex.EncodeToString(sum), nil
+}
+
+// digest hashes the AppImage with the contents of the skipped sections replaced by zero bytes
+func (ai AppImage) digest(h hash.Hash, sections map[string]Section, skip ...string) ([]byte, error) {
+	f, err := os.Open(ai.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var ranges []Section
+	for _, name := range skip {
+		if s, ok := sections[name]; ok {
+			ranges = append(ranges, s)
+		}
+	}
+	_, err = io.Copy(h, &zeroingReader{r: f, ranges: ranges})
+	if err != nil {
+		return nil, err
+	}
+	return h.Sum(nil), nil
+}
+
+// zeroingReader reads from r, replacing the bytes covered by ranges with zeros
+type zeroingReader struct {
+	r      io.Reader
+	pos    int64
+	ranges []Section
+}
+
+func (z *zeroingReader) Read(p []byte) (int, error) {
+	n, err := z.r.Read(p)
+	start, end := z.pos, z.pos+int64(n)
+	for _, s := range z.ranges {
+		from, to := s.Offset, s.Offset+s.Size
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		for i := from; i < to; i++ {
+			p[i-start] = 0
+		}
+	}
+	z.pos = end
+	return n, err
+}
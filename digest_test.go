@@ -0,0 +1,65 @@
+package goappimage
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"debug/elf"
+	"io/ioutil"
+	"testing"
+)
+
+// zeroedSum hashes the file at path with the named sections zeroed, finding them with debug/elf
+func zeroedSum(t *testing.T, path string, sum func([]byte) []byte, names ...string) []byte {
+	t.Helper()
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := elf.NewFile(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		s := f.Section(name)
+		if s == nil {
+			t.Fatalf("no %s section", name)
+		}
+		copy(data[s.Offset:], make([]byte, s.Size))
+	}
+	return sum(data)
+}
+
+func TestDigestZeroesTheSignatureSections(t *testing.T) {
+	path, _ := writeTestELF(t, []testSection{
+		{name: ".digest_md5", data: bytes.Repeat([]byte{1}, 16)},
+		{name: ".sha256_sig", data: bytes.Repeat([]byte{2}, 1024)},
+		{name: ".sig_key", data: bytes.Repeat([]byte{3}, 8192)},
+		{name: ".upd_info", data: bytes.Repeat([]byte{4}, 512)},
+	}, testSquashfs(8192))
+	ai := AppImage{Path: path}
+
+	digest, err := ai.Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sha := func(data []byte) []byte {
+		sum := sha256.Sum256(data)
+		return sum[:]
+	}
+	if want := zeroedSum(t, path, sha, ".sha256_sig", ".sig_key"); !bytes.Equal(digest, want) {
+		t.Errorf("Digest is %x, want %x", digest, want)
+	}
+
+	digest, err = ai.MD5Digest()
+	if err != nil {
+		t.Fatal(err)
+	}
+	md := func(data []byte) []byte {
+		sum := md5.Sum(data)
+		return sum[:]
+	}
+	if want := zeroedSum(t, path, md, ".digest_md5", ".sha256_sig", ".sig_key"); !bytes.Equal(digest, want) {
+		t.Errorf("MD5Digest is %x, want %x", digest, want)
+	}
+}
@@ -0,0 +1,174 @@
+package goappimage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// resumeSuffix is appended to a .part file for the state needed to resume downloading it
+const resumeSuffix = ".resume"
+
+// resumeState identifies the version of the remote file a .part file holds the beginning of
+type resumeState struct {
+	URL          string
+	ETag         string
+	LastModified string
+}
+
+// ifRange returns the validator to send in an If-Range header, or "" if the download cannot be resumed.
+// Weak ETags cannot be used for range requests.
+func (s resumeState) ifRange() string {
+	if s.ETag != "" && !strings.HasPrefix(s.ETag, "W/") {
+		return s.ETag
+	}
+	return s.LastModified
+}
+
+func readResumeState(part string) (resumeState, error) {
+	var state resumeState
+	data, err := ioutil.ReadFile(part + resumeSuffix)
+	if err != nil {
+		return state, err
+	}
+	return state, json.Unmarshal(data, &state)
+}
+
+func writeResumeState(part string, state resumeState) error {
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(part+resumeSuffix, data, 0644)
+}
+
+// Download downloads fileURL to destination. The data is written to destination + ".part" first,
+// which is renamed to destination when it is complete. If the download is interrupted, calling Download
+// again continues where it stopped, provided the server supports range requests and the file has not changed,
+// as told by its ETag or Last-Modified header. progress may be nil.
+func Download(fileURL string, destination string, progress ProgressFunc) error {
+	part := destination + PartialSuffix
+	p := newProgressReporter(progress)
+	p.enter(PhaseDownload)
+	err := downloadPart(http.DefaultClient, fileURL, part, p)
+	if err != nil {
+		return err
+	}
+	return os.Rename(part, destination)
+}
+
+// downloadPart downloads fileURL to part, resuming an earlier download of the same file into part.
+// The partial file and its resume state are kept if the download fails, and the state is removed when it succeeds.
+func downloadPart(client *http.Client, fileURL string, part string, p *progressReporter) error {
+	var offset int64
+	state, err := readResumeState(part)
+	if info, statErr := os.Stat(part); err == nil && statErr == nil && state.URL == fileURL && state.ifRange() != "" {
+		offset = info.Size()
+	}
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return err
+	}
+	if offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", offset))
+		// If the file has changed, the server sends all of it instead of the range
+		req.Header.Set("If-Range", state.ifRange())
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var total int64
+	switch resp.StatusCode {
+	case http.StatusOK:
+		offset = 0
+		if resp.ContentLength > 0 {
+			total = resp.ContentLength
+		}
+		state = resumeState{URL: fileURL, ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	case http.StatusPartialContent:
+		var start int64
+		_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &start, new(int64), &total)
+		if err != nil || start != offset {
+			return fmt.Errorf("%s: unexpected Content-Range %q", fileURL, resp.Header.Get("Content-Range"))
+		}
+	case http.StatusRequestedRangeNotSatisfiable:
+		// Either the .part file is complete already, or it is longer than the remote file, which must have changed
+		_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes */%d", &total)
+		if offset > 0 && err == nil && total == offset {
+			p.download(total, total, 0)
+			return os.Remove(part + resumeSuffix)
+		}
+		os.Remove(part)
+		os.Remove(part + resumeSuffix)
+		return errors.New(fileURL + " has changed since the download started, try again")
+	default:
+		return fmt.Errorf("%s: %s", fileURL, resp.Status)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE
+	if offset == 0 {
+		flags |= os.O_TRUNC
+	} else {
+		flags |= os.O_APPEND
+	}
+	out, err := os.OpenFile(part, flags, 0755)
+	if err != nil {
+		return err
+	}
+	if state.ifRange() != "" {
+		err = writeResumeState(part, state)
+	} else {
+		// Without a validator, a partial file cannot be trusted to belong to the same version
+		err = os.Remove(part + resumeSuffix)
+		if os.IsNotExist(err) {
+			err = nil
+		}
+	}
+	if err != nil {
+		out.Close()
+		return err
+	}
+
+	done := offset
+	_, err = io.Copy(out, &progressReader{r: resp.Body, onData: func(n int64) {
+		done += n
+		p.download(done, total, done-offset)
+	}})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	if total > 0 && done != total {
+		return fmt.Errorf("%s: got %d of %d bytes", fileURL, done, total)
+	}
+	p.download(done, done, done-offset)
+	err = os.Remove(part + resumeSuffix)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// progressReader tells onData how much has been read from r
+type progressReader struct {
+	r      io.Reader
+	onData func(int64)
+}
+
+func (pr *progressReader) Read(b []byte) (int, error) {
+	n, err := pr.r.Read(b)
+	if n > 0 {
+		pr.onData(int64(n))
+	}
+	return n, err
+}
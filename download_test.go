@@ -0,0 +1,205 @@
+package goappimage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// downloadServer serves content with an ETag and range requests. If cut is set, it stops sending a full response
+// after that many bytes, like a dropped connection.
+type downloadServer struct {
+	content  []byte
+	etag     string
+	cut      int
+	mu       sync.Mutex
+	requests []http.Header
+	sent     int64 // Accessed atomically
+}
+
+func (s *downloadServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.requests = append(s.requests, r.Header.Clone())
+	s.mu.Unlock()
+	w.Header().Set("ETag", s.etag)
+	if s.cut > 0 && r.Header.Get("Range") == "" {
+		w.Header().Set("Content-Length", strconv.Itoa(len(s.content)))
+		n, _ := w.Write(s.content[:s.cut])
+		atomic.AddInt64(&s.sent, int64(n))
+		return
+	}
+	http.ServeContent(&countingWriter{ResponseWriter: w, n: &s.sent}, r, "App.AppImage", time.Time{}, bytes.NewReader(s.content))
+}
+
+// request returns the headers of the ith request, counted from the end if i is negative
+func (s *downloadServer) request(i int) http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if i < 0 {
+		i += len(s.requests)
+	}
+	return s.requests[i]
+}
+
+func newDownloadServer(t *testing.T) (*downloadServer, string) {
+	content := make([]byte, 256<<10)
+	rand.New(rand.NewSource(1)).Read(content)
+	s := &downloadServer{content: content, etag: `"v1"`}
+	srv := httptest.NewServer(s)
+	t.Cleanup(srv.Close)
+	return s, srv.URL + "/App.AppImage"
+}
+
+// recordProgress returns a ProgressFunc that appends to progress
+func recordProgress(progress *[]Progress) ProgressFunc {
+	return func(p Progress) {
+		*progress = append(*progress, p)
+	}
+}
+
+// checkDownloadProgress checks that the download phase was entered and ended with all of the file
+func checkDownloadProgress(t *testing.T, name string, progress []Progress, total int64) {
+	t.Helper()
+	if len(progress) < 2 || progress[0] != (Progress{Phase: PhaseDownload}) {
+		t.Errorf("%s: progress starts with %+v", name, progress)
+		return
+	}
+	for i, p := range progress {
+		if p.Phase != PhaseDownload || p.Done < 0 || p.Rate < 0 || (i > 0 && p.Done < progress[i-1].Done) {
+			t.Errorf("%s: progress %+v", name, progress)
+			return
+		}
+	}
+	if last := progress[len(progress)-1]; last.Done != total || last.Total != total {
+		t.Errorf("%s: progress ends with %+v, want %d bytes", name, last, total)
+	}
+}
+
+func checkDownloaded(t *testing.T, name string, destination string, content []byte) {
+	t.Helper()
+	if data, err := ioutil.ReadFile(destination); err != nil || !bytes.Equal(data, content) {
+		t.Errorf("%s: the download differs: %v", name, err)
+	}
+	for _, suffix := range []string{PartialSuffix, PartialSuffix + resumeSuffix} {
+		if _, err := os.Stat(destination + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s: %s is left behind: %v", name, suffix, err)
+		}
+	}
+}
+
+func TestDownloadResumes(t *testing.T) {
+	s, fileURL := newDownloadServer(t)
+	destination := filepath.Join(t.TempDir(), "App.AppImage")
+	s.cut = 100000
+	if err := Download(fileURL, destination, nil); err == nil {
+		t.Fatal("expected an error for a dropped connection")
+	}
+	if info, err := os.Stat(destination + PartialSuffix); err != nil || info.Size() != int64(s.cut) {
+		t.Fatalf("the partial download is not kept: %v, %v", info, err)
+	}
+	if state, err := readResumeState(destination + PartialSuffix); err != nil || state.URL != fileURL || state.ETag != s.etag {
+		t.Fatalf("resume state %+v, %v", state, err)
+	}
+
+	atomic.StoreInt64(&s.sent, 0)
+	var progress []Progress
+	if err := Download(fileURL, destination, recordProgress(&progress)); err != nil {
+		t.Fatal(err)
+	}
+	req := s.request(-1)
+	if req.Get("Range") != "bytes=100000-" || req.Get("If-Range") != s.etag {
+		t.Errorf("resumed with Range %q, If-Range %q", req.Get("Range"), req.Get("If-Range"))
+	}
+	if sent := atomic.LoadInt64(&s.sent); sent != int64(len(s.content)-s.cut) {
+		t.Errorf("%d bytes were sent again, want %d", sent, len(s.content)-s.cut)
+	}
+	checkDownloaded(t, "resumed", destination, s.content)
+	checkDownloadProgress(t, "resumed", progress, int64(len(s.content)))
+}
+
+func TestDownloadRestartsWhenTheFileChanged(t *testing.T) {
+	s, fileURL := newDownloadServer(t)
+	destination := filepath.Join(t.TempDir(), "App.AppImage")
+	part := destination + PartialSuffix
+	if err := ioutil.WriteFile(part, bytes.Repeat([]byte{1}, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResumeState(part, resumeState{URL: fileURL, ETag: `"v0"`}); err != nil {
+		t.Fatal(err)
+	}
+
+	var progress []Progress
+	if err := Download(fileURL, destination, recordProgress(&progress)); err != nil {
+		t.Fatal(err)
+	}
+	// The server answers 200 with all of the new version
+	if req := s.request(0); req.Get("Range") != "bytes=1000-" || req.Get("If-Range") != `"v0"` {
+		t.Errorf("asked with Range %q, If-Range %q", req.Get("Range"), req.Get("If-Range"))
+	}
+	checkDownloaded(t, "changed", destination, s.content)
+	checkDownloadProgress(t, "changed", progress, int64(len(s.content)))
+
+	// A .part file without resume state is not trusted either
+	if err := ioutil.WriteFile(part, bytes.Repeat([]byte{1}, 1000), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Download(fileURL, destination, nil); err != nil {
+		t.Fatal(err)
+	}
+	if req := s.request(1); req.Get("Range") != "" {
+		t.Errorf("resumed without resume state, Range %q", req.Get("Range"))
+	}
+	checkDownloaded(t, "no state", destination, s.content)
+}
+
+func TestDownloadOfACompletePart(t *testing.T) {
+	s, fileURL := newDownloadServer(t)
+	destination := filepath.Join(t.TempDir(), "App.AppImage")
+	part := destination + PartialSuffix
+	if err := ioutil.WriteFile(part, s.content, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResumeState(part, resumeState{URL: fileURL, ETag: s.etag}); err != nil {
+		t.Fatal(err)
+	}
+
+	// The server answers 416, there is nothing left to download
+	var progress []Progress
+	if err := Download(fileURL, destination, recordProgress(&progress)); err != nil {
+		t.Fatal(err)
+	}
+	if req := s.request(0); req.Get("Range") != "bytes=262144-" || req.Get("If-Range") != s.etag {
+		t.Errorf("asked with Range %q, If-Range %q", req.Get("Range"), req.Get("If-Range"))
+	}
+	// Only the text of the error
+	if sent := atomic.LoadInt64(&s.sent); sent > 100 {
+		t.Errorf("%d bytes were sent", sent)
+	}
+	checkDownloaded(t, "complete", destination, s.content)
+	checkDownloadProgress(t, "complete", progress, int64(len(s.content)))
+
+	// A .part file longer than the remote file belongs to another version, and is removed
+	if err := ioutil.WriteFile(part, append(s.content, 0), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeResumeState(part, resumeState{URL: fileURL, ETag: s.etag}); err != nil {
+		t.Fatal(err)
+	}
+	if err := Download(fileURL, destination, nil); err == nil {
+		t.Error("expected an error for a .part file longer than the remote file")
+	}
+	for _, suffix := range []string{PartialSuffix, PartialSuffix + resumeSuffix} {
+		if _, err := os.Stat(destination + suffix); !os.IsNotExist(err) {
+			t.Errorf("%s is left behind: %v", suffix, err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package goappimage
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// dwarfsReader reads DwarFS payloads using dwarfsextract, which can only extract the image as a whole.
+// Hence the image is extracted into a temporary directory the first time a file is needed,
+// and everything else works on that directory. Metadata does not need the files.
+type dwarfsReader struct {
+	ai      AppImage
+	verbose bool
+	once    sync.Once
+	root    string
+	err     error
+}
+
+func newDwarfsReader(ai AppImage, verbose bool) (PayloadReader, error) {
+	return &dwarfsReader{ai: ai, verbose: verbose}, nil
+}
+
+// extract extracts the image unless that has been done already
+func (r *dwarfsReader) extract() error {
+	r.once.Do(func() {
+		root, err := ioutil.TempDir("", "goappimage-dwarfs-")
+		if err != nil {
+			r.err = err
+			return
+		}
+		cmd := exec.Command("dwarfsextract", "-i", r.ai.Path, "-O", strconv.FormatInt(r.ai.Offset, 10), "-o", root)
+		_, err = runCommand(cmd, r.verbose)
+		if err != nil {
+			os.RemoveAll(root)
+			r.err = err
+			return
+		}
+		r.root = root
+	})
+	return r.err
+}
+
+// path returns where the named file has been extracted to
+func (r *dwarfsReader) path(name string) (string, error) {
+	err := r.extract()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(r.root, filepath.FromSlash(cleanPayloadName(name))), nil
+}
+
+func (r *dwarfsReader) Open(name string) (io.ReadCloser, error) {
+	p, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (r *dwarfsReader) ReadDir(name string) ([]os.FileInfo, error) {
+	p, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(p)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+func (r *dwarfsReader) Stat(name string) (os.FileInfo, error) {
+	p, err := r.path(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Lstat(p)
+}
+
+func (r *dwarfsReader) Readlink(name string) (string, error) {
+	p, err := r.path(name)
+	if err != nil {
+		return "", err
+	}
+	return os.Readlink(p)
+}
+
+// Metadata leaves FSTime zero, since dwarfsextract does not tell when the image was created
+// and the times of the extracted files say nothing about it
+func (r *dwarfsReader) Metadata() (PayloadMetadata, error) {
+	return PayloadMetadata{Format: PayloadDwarfs}, nil
+}
+
+// Extract copies the files matching pattern out of the extracted image.
+// The pattern is relative to the root of the image, and nothing outside of it is matched,
+// neither through ../ in pattern nor through symlinks in the image.
+func (r *dwarfsReader) Extract(pattern string, destinationdirpath string) error {
+	glob, err := r.path(pattern)
+	if err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(r.root)
+	if err != nil {
+		return err
+	}
+	matches, err := filepath.Glob(glob)
+	if err != nil {
+		return err
+	}
+	for _, match := range matches {
+		dir, err := filepath.EvalSymlinks(filepath.Dir(match))
+		if err != nil {
+			return err
+		}
+		if !isWithin(root, dir) {
+			return fmt.Errorf("%s is outside of the payload", match)
+		}
+		rel, _ := filepath.Rel(r.root, match)
+		err = copyTree(match, filepath.Join(destinationdirpath, rel))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// List returns one "mode size mtime path" line per file, similar to unsquashfs -ll
+func (r *dwarfsReader) List() (string, error) {
+	err := r.extract()
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	err = filepath.Walk(r.root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(r.root, path)
+		line := fmt.Sprintf("%s %d %s %s", info.Mode(), info.Size(), info.ModTime().Format("2006-01-02 15:04"), rel)
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, _ := os.Readlink(path)
+			line += " -> " + target
+		}
+		sb.WriteString(line + "\n")
+		return nil
+	})
+	return sb.String(), err
+}
+
+func (r *dwarfsReader) Close() error {
+	if r.root == "" {
+		return nil
+	}
+	return os.RemoveAll(r.root)
+}
+
+// isWithin returns true if p is dir or inside of it
+func isWithin(dir string, p string) bool {
+	rel, err := filepath.Rel(dir, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// copyTree copies src to dst, recursing into directories and preserving symlinks and modes
+func copyTree(src string, dst string) error {
+	info, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(dst), os.ModePerm)
+	if err != nil {
+		return err
+	}
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(src)
+		if err != nil {
+			return err
+		}
+		os.Remove(dst)
+		return os.Symlink(target, dst)
+	case info.IsDir():
+		err = os.MkdirAll(dst, info.Mode().Perm())
+		if err != nil {
+			return err
+		}
+		children, err := ioutil.ReadDir(src)
+		if err != nil {
+			return err
+		}
+		for _, child := range children {
+			err = copyTree(filepath.Join(src, child.Name()), filepath.Join(dst, child.Name()))
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
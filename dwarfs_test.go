@@ -0,0 +1,77 @@
+package goappimage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// extractedDwarfsReader returns a dwarfsReader that acts as if the image had been extracted to root
+func extractedDwarfsReader(root string) *dwarfsReader {
+	r := &dwarfsReader{root: root}
+	r.once.Do(func() {})
+	return r
+}
+
+func TestDwarfsMetadataDoesNotExtract(t *testing.T) {
+	payload, err := newDwarfsReader(AppImage{Path: filepath.Join(t.TempDir(), "missing.AppImage")}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer payload.Close()
+	metadata, err := payload.Metadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if metadata.Format != PayloadDwarfs || !metadata.FSTime.IsZero() {
+		t.Errorf("unexpected metadata %+v", metadata)
+	}
+	if r := payload.(*dwarfsReader); r.root != "" {
+		t.Errorf("the image has been extracted to %s", r.root)
+	}
+}
+
+func TestDwarfsExtractStaysInsideThePayload(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "root")
+	outside := filepath.Join(dir, "outside")
+	for _, d := range []string{filepath.Join(root, "usr"), outside} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "usr", "app"), []byte("app"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(outside, "secret"), []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(root, "link")); err != nil {
+		t.Fatal(err)
+	}
+	r := extractedDwarfsReader(root)
+
+	dest := filepath.Join(dir, "dest")
+	if err := r.Extract("../outside/*", dest); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "outside", "secret")); err == nil {
+		t.Error("../ in the pattern extracted a file outside of the payload")
+	}
+	if err := r.Extract("link/*", dest); err == nil {
+		t.Error("a symlink in the payload extracted a file outside of it")
+	}
+	if err := r.Extract("link", dest); err != nil {
+		t.Fatal(err)
+	}
+	if target, err := os.Readlink(filepath.Join(dest, "link")); err != nil || target != outside {
+		t.Errorf("link extracted as %q, %v", target, err)
+	}
+	if err := r.Extract("usr/*", dest); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(filepath.Join(dest, "usr", "app")); err != nil || string(data) != "app" {
+		t.Errorf("usr/app extracted as %q, %v", data, err)
+	}
+}
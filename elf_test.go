@@ -0,0 +1,80 @@
+package goappimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+)
+
+// testSection is a section of an ELF file written by writeTestELF.
+// If size is not 0, it is written to the section header instead of the length of data.
+type testSection struct {
+	name string
+	data []byte
+	size uint64
+}
+
+// writeTestELF writes a minimal little-endian ELF64 file with the sections, followed by payload,
+// and returns its path and the offset of payload
+func writeTestELF(t *testing.T, sections []testSection, payload []byte) (string, int64) {
+	t.Helper()
+	var body bytes.Buffer
+	body.Write(make([]byte, 64)) // ELF header, written last
+	shstrtab := []byte{0}
+	type header struct {
+		name   uint32
+		typ    uint32
+		offset uint64
+		size   uint64
+	}
+	headers := []header{{}}
+	for _, s := range sections {
+		h := header{name: uint32(len(shstrtab)), typ: 1, offset: uint64(body.Len()), size: uint64(len(s.data))}
+		if s.size != 0 {
+			h.size = s.size
+		}
+		shstrtab = append(append(shstrtab, s.name...), 0)
+		body.Write(s.data)
+		headers = append(headers, h)
+	}
+	strtab := header{name: uint32(len(shstrtab)), typ: 3, offset: uint64(body.Len())}
+	shstrtab = append(append(shstrtab, ".shstrtab"...), 0)
+	strtab.size = uint64(len(shstrtab))
+	body.Write(shstrtab)
+	headers = append(headers, strtab)
+
+	shoff := uint64(body.Len())
+	for _, h := range headers {
+		sh := make([]byte, 64)
+		binary.LittleEndian.PutUint32(sh[0:], h.name)
+		binary.LittleEndian.PutUint32(sh[4:], h.typ)
+		binary.LittleEndian.PutUint64(sh[24:], h.offset)
+		binary.LittleEndian.PutUint64(sh[32:], h.size)
+		binary.LittleEndian.PutUint64(sh[48:], 1)
+		body.Write(sh)
+	}
+	payloadOffset := int64(body.Len())
+	body.Write(payload)
+
+	data := body.Bytes()
+	copy(data, []byte{0x7f, 'E', 'L', 'F', 2, 1, 1})
+	// AppImage magic in the padding of e_ident, type 2
+	copy(data[8:], []byte{'A', 'I', 2})
+	binary.LittleEndian.PutUint16(data[16:], 2)    // ET_EXEC
+	binary.LittleEndian.PutUint16(data[18:], 0x3e) // x86-64
+	binary.LittleEndian.PutUint32(data[20:], 1)
+	binary.LittleEndian.PutUint64(data[40:], shoff)
+	binary.LittleEndian.PutUint16(data[52:], 64)
+	binary.LittleEndian.PutUint16(data[58:], 64)
+	binary.LittleEndian.PutUint16(data[60:], uint16(len(headers)))
+	binary.LittleEndian.PutUint16(data[62:], uint16(len(headers)-1))
+
+	path := filepath.Join(t.TempDir(), "Test-x86_64.AppImage")
+	err := ioutil.WriteFile(path, data, 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path, payloadOffset
+}
@@ -0,0 +1,157 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GitHubRelease is a release as returned by the GitHub Releases API
+type GitHubRelease struct {
+	TagName     string        `json:"tag_name"`
+	Name        string        `json:"name"`
+	Body        string        `json:"body"`
+	Draft       bool          `json:"draft"`
+	Prerelease  bool          `json:"prerelease"`
+	PublishedAt time.Time     `json:"published_at"`
+	Assets      []GitHubAsset `json:"assets"`
+}
+
+// GitHubAsset is a file attached to a GitHubRelease
+type GitHubAsset struct {
+	Name               string    `json:"name"`
+	URL                string    `json:"url"` // Of the asset in the API, which private repositories need for downloads
+	BrowserDownloadURL string    `json:"browser_download_url"`
+	Size               int64     `json:"size"`
+	UpdatedAt          time.Time `json:"updated_at"`
+}
+
+// GitHubClient talks to the GitHub Releases API.
+// BaseURL can be pointed at GitHub Enterprise or a local test server.
+// Token is needed for private repositories and raises the rate limit. Responses are kept in Cache if it is set.
+type GitHubClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      string
+	Cache      *APICache
+}
+
+// DefaultGitHubClient is used to resolve gh-releases-* update information.
+// It uses the token in $GITHUB_TOKEN, if any.
+var DefaultGitHubClient = &GitHubClient{
+	BaseURL: "https://api.github.com",
+	Token:   os.Getenv("GITHUB_TOKEN"),
+	Cache:   DefaultAPICache,
+}
+
+func (c *GitHubClient) getJSON(apiPath string, v interface{}) error {
+	header := http.Header{}
+	header.Set("Accept", "application/vnd.github.v3+json")
+	if c.Token != "" {
+		header.Set("Authorization", "token "+c.Token)
+	}
+	return apiRequest{
+		Name:       "GitHub API",
+		URL:        strings.TrimSuffix(c.BaseURL, "/") + apiPath,
+		Header:     header,
+		Token:      c.Token,
+		HTTPClient: c.HTTPClient,
+		Cache:      c.Cache,
+	}.getJSON(v)
+}
+
+// Release returns the release of owner/repo with the tag name.
+// "latest" is the latest release as determined by the GitHub API, which never is a pre-release.
+func (c *GitHubClient) Release(owner string, repo string, name string) (*GitHubRelease, error) {
+	apiPath := "/repos/" + url.PathEscape(owner) + "/" + url.PathEscape(repo) + "/releases/"
+	if name == "latest" {
+		apiPath += "latest"
+	} else {
+		apiPath += "tags/" + url.PathEscape(name)
+	}
+	var release GitHubRelease
+	err := c.getJSON(apiPath, &release)
+	if err != nil {
+		return nil, err
+	}
+	return &release, nil
+}
+
+// The GitHub API returns at most this many releases per request
+const gitHubReleasesPerPage = 100
+
+// Repositories with more releases than this are cut off, to not use up the rate limit on a single call
+const maxGitHubReleasePages = 10
+
+// Releases returns the releases of owner/repo, newest first, including pre-releases.
+// At most 1000 releases are returned.
+func (c *GitHubClient) Releases(owner string, repo string) ([]GitHubRelease, error) {
+	return c.releasesWhile(owner, repo, func([]GitHubRelease) bool { return true })
+}
+
+// releasesWhile reads the releases of owner/repo page by page, as long as more returns true for the last page
+func (c *GitHubClient) releasesWhile(owner string, repo string, more func(page []GitHubRelease) bool) ([]GitHubRelease, error) {
+	var releases []GitHubRelease
+	for page := 1; page <= maxGitHubReleasePages; page++ {
+		var p []GitHubRelease
+		err := c.getJSON(fmt.Sprintf("/repos/%s/%s/releases?per_page=%d&page=%d",
+			url.PathEscape(owner), url.PathEscape(repo), gitHubReleasesPerPage, page), &p)
+		if err != nil {
+			return releases, err
+		}
+		releases = append(releases, p...)
+		if len(p) < gitHubReleasesPerPage || !more(p) {
+			break
+		}
+	}
+	return releases, nil
+}
+
+// FindAsset returns the first asset of the release whose name matches pattern, see MatchUpdateFilename
+func (r *GitHubRelease) FindAsset(pattern string) (*GitHubAsset, error) {
+	for i, a := range r.Assets {
+		ok, err := MatchUpdateFilename(pattern, a.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &r.Assets[i], nil
+		}
+	}
+	return nil, errors.New("no file matching " + pattern + " in release " + r.TagName)
+}
+
+// assetClient returns the client to download the assets of release with.
+// With a Token, the assets are downloaded through the API, since browser_download_url does not take tokens.
+// This covers the AppImage a .zsync file points to relative to its browser_download_url, too.
+func (c *GitHubClient) assetClient(release *GitHubRelease) *http.Client {
+	if c.Token == "" {
+		return c.HTTPClient
+	}
+	t := &assetTransport{rewrite: make(map[string]string), header: http.Header{}}
+	t.header.Set("Accept", "application/octet-stream")
+	t.header.Set("Authorization", "token "+c.Token)
+	for _, a := range release.Assets {
+		if u, err := url.Parse(a.BrowserDownloadURL); err == nil && a.URL != "" {
+			t.rewrite[u.String()] = a.URL
+		}
+	}
+	return withAssetTransport(c.HTTPClient, t)
+}
+
+// resolveGitHubReleases returns the asset the gh-releases-* update information points to, and where to download it from
+func (ui UpdateInformation) resolveGitHubReleases(c *GitHubClient, zsync bool) (UpdateTarget, *GitHubAsset, error) {
+	release, err := c.Release(ui.Username(), ui.Repository(), ui.ReleaseName())
+	if err != nil {
+		return UpdateTarget{}, nil, err
+	}
+	asset, err := release.FindAsset(ui.Filename())
+	if err != nil {
+		return UpdateTarget{}, nil, err
+	}
+	return UpdateTarget{URL: asset.BrowserDownloadURL, Zsync: zsync, Client: c.assetClient(release)}, asset, nil
+}
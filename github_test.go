@@ -0,0 +1,220 @@
+package goappimage
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// serveGitHubReleases serves n releases v<n>.0 down to v1.0 of owner/repo, newest first
+func serveGitHubReleases(t *testing.T, n int, requests *[]string) *GitHubClient {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*requests = append(*requests, r.URL.RequestURI())
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest":
+			json.NewEncoder(w).Encode(GitHubRelease{TagName: fmt.Sprintf("v%d.0", n)})
+		case "/repos/owner/repo/releases":
+			page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+			perPage, _ := strconv.Atoi(r.URL.Query().Get("per_page"))
+			releases := []GitHubRelease{}
+			for i := n - (page-1)*perPage; i > 0 && i > n-page*perPage; i-- {
+				releases = append(releases, GitHubRelease{TagName: fmt.Sprintf("v%d.0", i), Body: "Changes"})
+			}
+			json.NewEncoder(w).Encode(releases)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return &GitHubClient{BaseURL: srv.URL, HTTPClient: srv.Client()}
+}
+
+func TestGitHubReleasesArePaginated(t *testing.T) {
+	var requests []string
+	c := serveGitHubReleases(t, 250, &requests)
+	releases, err := c.Releases("owner", "repo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(releases) != 250 || releases[0].TagName != "v250.0" || releases[249].TagName != "v1.0" {
+		t.Errorf("got %d releases", len(releases))
+	}
+	if len(requests) != 3 {
+		t.Errorf("expected 3 pages, got %v", requests)
+	}
+}
+
+func TestGitHubChangelogStopsAtInstalledVersion(t *testing.T) {
+	var requests []string
+	c := serveGitHubReleases(t, 250, &requests)
+	ui, err := ParseUpdateInformation("gh-releases-zsync|owner|repo|latest|App-*.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	entries, err := ui.gitHubChangelog(c, "247.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 3 || entries[0].Version != "250.0" || entries[2].Version != "248.0" {
+		t.Errorf("unexpected entries %+v", entries)
+	}
+	// The latest release and the first page of releases
+	if len(requests) != 2 {
+		t.Errorf("expected 2 requests, got %v", requests)
+	}
+}
+
+// servePrivateGitHubRelease serves a release of a private repository, whose assets can only be
+// downloaded through the API with a token, which redirects to the storage
+func servePrivateGitHubRelease(t *testing.T, storageAuth *[]string) *httptest.Server {
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest":
+			json.NewEncoder(w).Encode(GitHubRelease{TagName: "v1.0", Assets: []GitHubAsset{
+				{Name: "App.AppImage.zsync", URL: srv.URL + "/api/assets/1", BrowserDownloadURL: srv.URL + "/download/v1.0/App.AppImage.zsync"},
+				{Name: "App.AppImage", URL: srv.URL + "/api/assets/2", BrowserDownloadURL: srv.URL + "/download/v1.0/App.AppImage"},
+			}})
+		case "/api/assets/1", "/api/assets/2":
+			if r.Header.Get("Authorization") != "token secret" || r.Header.Get("Accept") != "application/octet-stream" {
+				http.NotFound(w, r)
+				return
+			}
+			http.Redirect(w, r, srv.URL+"/storage"+r.URL.Path, http.StatusFound)
+		case "/storage/api/assets/1", "/storage/api/assets/2":
+			*storageAuth = append(*storageAuth, r.Header.Get("Authorization"))
+			w.Write([]byte("content of " + r.URL.Path))
+		default:
+			// Like browser_download_url of a private repository
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestPrivateGitHubAssetsAreDownloadedThroughTheAPI(t *testing.T) {
+	var storageAuth []string
+	srv := servePrivateGitHubRelease(t, &storageAuth)
+	c := &GitHubClient{BaseURL: srv.URL, HTTPClient: srv.Client(), Token: "secret"}
+
+	ui, err := ParseUpdateInformation("gh-releases-direct|owner|repo|latest|App.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _, err := ui.resolveGitHubReleases(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	part := filepath.Join(t.TempDir(), "App.AppImage"+PartialSuffix)
+	err = downloadPart(target.httpClient(), target.URL, part, newProgressReporter(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(part); string(data) != "content of /storage/api/assets/2" {
+		t.Errorf("downloaded %q", data)
+	}
+
+	// The AppImage a .zsync file points to relative to its own URL is downloaded through the API, too
+	ui, err = ParseUpdateInformation("gh-releases-zsync|owner|repo|latest|App.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, _, err = ui.resolveGitHubReleases(c, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	base, _ := url.Parse(target.URL)
+	ref, _ := url.Parse("App.AppImage")
+	resp, err := target.httpClient().Get(base.ResolveReference(ref).String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("relative URL of the zsync target: %s", resp.Status)
+	}
+
+	if len(storageAuth) != 2 || storageAuth[0] != "" || storageAuth[1] != "" {
+		t.Errorf("storage got Authorization %q, want none", storageAuth)
+	}
+}
+
+func TestPublicGitHubAssetsUseTheConfiguredClient(t *testing.T) {
+	client := &http.Client{}
+	c := &GitHubClient{HTTPClient: client}
+	if c.assetClient(&GitHubRelease{}) != client {
+		t.Error("the configured client is not used without a token")
+	}
+}
+
+// useGitHubServer points DefaultGitHubClient at srv until the test ends
+func useGitHubServer(t *testing.T, srv *httptest.Server) {
+	old := DefaultGitHubClient
+	DefaultGitHubClient = &GitHubClient{BaseURL: srv.URL, HTTPClient: srv.Client()}
+	t.Cleanup(func() { DefaultGitHubClient = old })
+}
+
+func TestGitHubReleasesDirect(t *testing.T) {
+	current := writeSignableAppImage(t, 1)
+	update := signedAppImage(t, nil, 2)
+	updatedAt := time.Now().Add(time.Hour).UTC().Truncate(time.Second)
+	var asset GitHubAsset
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/repos/owner/repo/releases/latest":
+			json.NewEncoder(w).Encode(GitHubRelease{TagName: "v2.0", Assets: []GitHubAsset{
+				{Name: "App-2.0-x86_64.AppImage.zsync", BrowserDownloadURL: srv.URL + "/download/v2.0/App-2.0-x86_64.AppImage.zsync"},
+				asset,
+			}})
+		case "/download/v2.0/App-2.0-x86_64.AppImage":
+			w.Write(update)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	useGitHubServer(t, srv)
+	current.UpdateInformation, _ = ParseUpdateInformation("gh-releases-direct|owner|repo|latest|App-*-x86_64.AppImage")
+
+	// Without a zsync file, the size and time GitHub reports for the asset are compared with the local file
+	info, err := os.Stat(current.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assetURL := srv.URL + "/download/v2.0/App-2.0-x86_64.AppImage"
+	asset = GitHubAsset{Name: "App-2.0-x86_64.AppImage", BrowserDownloadURL: assetURL, Size: info.Size(), UpdatedAt: info.ModTime().Add(-time.Hour)}
+	check, err := CheckForUpdate(current)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Available || check.Filename != asset.Name || check.Target.URL != assetURL || check.Target.Zsync {
+		t.Errorf("same size and older: %+v", check)
+	}
+	asset.UpdatedAt = updatedAt
+	if check, err = CheckForUpdate(current); err != nil || !check.Available || !check.MTime.Equal(updatedAt) {
+		t.Errorf("newer: %+v, %v", check, err)
+	}
+	asset = GitHubAsset{Name: asset.Name, BrowserDownloadURL: assetURL, Size: info.Size() + 1}
+	if check, err = CheckForUpdate(current); err != nil || !check.Available || check.Size != info.Size()+1 {
+		t.Errorf("other size: %+v, %v", check, err)
+	}
+
+	// The whole file is downloaded from the asset
+	if _, err = Update(current, UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(current.Path); err != nil || !bytes.Equal(data, update) {
+		t.Errorf("the update was not installed: %v", err)
+	}
+}
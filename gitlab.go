@@ -0,0 +1,158 @@
+package goappimage
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// GitLabRelease is a release as returned by the GitLab Releases API
+type GitLabRelease struct {
+	TagName     string    `json:"tag_name"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	ReleasedAt  time.Time `json:"released_at"`
+	Assets      struct {
+		Links []GitLabAssetLink `json:"links"`
+	} `json:"assets"`
+}
+
+// GitLabAssetLink is a file attached to a GitLabRelease
+type GitLabAssetLink struct {
+	Name           string `json:"name"`
+	URL            string `json:"url"`
+	DirectAssetURL string `json:"direct_asset_url"`
+}
+
+// DownloadURL returns the URL the asset can be downloaded from
+func (l GitLabAssetLink) DownloadURL() string {
+	if l.DirectAssetURL != "" {
+		return l.DirectAssetURL
+	}
+	return l.URL
+}
+
+// GitLabClient talks to the GitLab Releases API of gitlab.com or a self-hosted instance at BaseURL.
+// Token is a personal, project or group access token, needed for private projects.
+// Responses are kept in Cache if it is set.
+type GitLabClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+	Token      string
+	Cache      *APICache
+}
+
+// DefaultGitLabClient is used to resolve gitlab-releases-* update information.
+// These name the GitLab instance themselves, which replaces BaseURL. Token is only used for the instance
+// at BaseURL, by default the token in $GITLAB_TOKEN, if any, for gitlab.com.
+var DefaultGitLabClient = &GitLabClient{
+	BaseURL: "https://gitlab.com",
+	Token:   os.Getenv("GITLAB_TOKEN"),
+	Cache:   DefaultAPICache,
+}
+
+// GitLabTokens are the access tokens used to resolve gitlab-releases-* update information by host,
+// e.g., "gitlab.example.com". Hosts that are neither in it nor at the BaseURL of the client get no token,
+// since the host comes from the AppImage.
+var GitLabTokens = map[string]string{}
+
+// withBaseURL returns a copy of c for the GitLab instance at baseURL.
+// It keeps the Token only if baseURL is the instance at c.BaseURL, otherwise the token in GitLabTokens
+// for its host is used, if any.
+func (c *GitLabClient) withBaseURL(baseURL string) *GitLabClient {
+	instance := *c
+	instance.BaseURL = baseURL
+	instance.Token = ""
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return &instance
+	}
+	if configured, err := url.Parse(c.BaseURL); err == nil && configured.Scheme == u.Scheme && configured.Host == u.Host {
+		instance.Token = c.Token
+	}
+	if token, ok := GitLabTokens[u.Host]; ok {
+		instance.Token = token
+	}
+	return &instance
+}
+
+// assetClient returns the client to download assets with, which sends the Token to the instance
+// but not to other hosts the assets may link to
+func (c *GitLabClient) assetClient() *http.Client {
+	u, err := url.Parse(c.BaseURL)
+	if c.Token == "" || err != nil {
+		return c.HTTPClient
+	}
+	t := &assetTransport{host: u.Host, header: http.Header{}}
+	t.header.Set("PRIVATE-TOKEN", c.Token)
+	return withAssetTransport(c.HTTPClient, t)
+}
+
+func (c *GitLabClient) getJSON(apiPath string, v interface{}) error {
+	header := http.Header{}
+	if c.Token != "" {
+		header.Set("PRIVATE-TOKEN", c.Token)
+	}
+	return apiRequest{
+		Name:       "GitLab API",
+		URL:        strings.TrimSuffix(c.BaseURL, "/") + "/api/v4" + apiPath,
+		Header:     header,
+		Token:      c.Token,
+		HTTPClient: c.HTTPClient,
+		Cache:      c.Cache,
+	}.getJSON(v)
+}
+
+// Release returns the release of the project (e.g., "group/subgroup/project") with the tag name.
+// "latest" is the most recently released one.
+func (c *GitLabClient) Release(project string, name string) (*GitLabRelease, error) {
+	apiPath := "/projects/" + url.PathEscape(project) + "/releases"
+	if name != "latest" {
+		var release GitLabRelease
+		err := c.getJSON(apiPath+"/"+url.PathEscape(name), &release)
+		if err != nil {
+			return nil, err
+		}
+		return &release, nil
+	}
+	var releases []GitLabRelease
+	err := c.getJSON(apiPath+"?order_by=released_at&sort=desc&per_page=1", &releases)
+	if err != nil {
+		return nil, err
+	}
+	if len(releases) == 0 {
+		return nil, errors.New("GitLab project " + project + " has no releases")
+	}
+	return &releases[0], nil
+}
+
+// FindAsset returns the first asset of the release whose name matches pattern, see MatchUpdateFilename
+func (r *GitLabRelease) FindAsset(pattern string) (*GitLabAssetLink, error) {
+	for i, l := range r.Assets.Links {
+		ok, err := MatchUpdateFilename(pattern, l.Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &r.Assets.Links[i], nil
+		}
+	}
+	return nil, errors.New("no file matching " + pattern + " in release " + r.TagName)
+}
+
+// resolveGitLabReleases returns where to download the asset gitlab-releases-* update information points to
+func (ui UpdateInformation) resolveGitLabReleases(c *GitLabClient, zsync bool) (UpdateTarget, error) {
+	c = c.withBaseURL(ui.field(0))
+	release, err := c.Release(ui.field(1), ui.field(2))
+	if err != nil {
+		return UpdateTarget{}, err
+	}
+	asset, err := release.FindAsset(ui.field(3))
+	if err != nil {
+		return UpdateTarget{}, err
+	}
+	return UpdateTarget{URL: asset.DownloadURL(), Zsync: zsync, Client: c.assetClient()}, nil
+}
@@ -0,0 +1,97 @@
+package goappimage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+// serveGitLab serves the releases of group/project, the latest of which has the assets
+func serveGitLab(t *testing.T, assets []GitLabAssetLink, handle func(r *http.Request)) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if handle != nil {
+			handle(r)
+		}
+		if r.URL.EscapedPath() != "/api/v4/projects/group%2Fproject/releases" {
+			http.NotFound(w, r)
+			return
+		}
+		release := GitLabRelease{TagName: "v1.0"}
+		release.Assets.Links = assets
+		json.NewEncoder(w).Encode([]GitLabRelease{release})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestResolveGitLabReleases(t *testing.T) {
+	srv := serveGitLab(t, []GitLabAssetLink{
+		{Name: "App-1.0-x86_64.AppImage.zsync", URL: "https://example.com/link", DirectAssetURL: "https://example.com/direct"},
+	}, nil)
+	ui, err := ParseUpdateInformation("gitlab-releases-zsync|" + srv.URL + "|group/project|latest|App-*-x86_64.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := ui.resolveGitLabReleases(&GitLabClient{HTTPClient: srv.Client()}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.URL != "https://example.com/direct" || !target.Zsync {
+		t.Errorf("resolved to %+v", target)
+	}
+}
+
+func TestGitLabTokensOnlyGoToConfiguredHosts(t *testing.T) {
+	var tokens []string
+	srv := serveGitLab(t, []GitLabAssetLink{{Name: "App.AppImage", URL: "https://example.com/App.AppImage"}}, func(r *http.Request) {
+		tokens = append(tokens, r.Header.Get("PRIVATE-TOKEN"))
+	})
+	ui, err := ParseUpdateInformation("gitlab-releases-direct|" + srv.URL + "|group/project|latest|App.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	configured := &GitLabClient{BaseURL: srv.URL, HTTPClient: srv.Client(), Token: "secret"}
+	other := &GitLabClient{BaseURL: "https://gitlab.com", HTTPClient: srv.Client(), Token: "secret"}
+	for _, c := range []*GitLabClient{configured, other} {
+		_, err = ui.resolveGitLabReleases(c, false)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(tokens) != 2 || tokens[0] != "secret" || tokens[1] != "" {
+		t.Errorf("sent tokens %q, want the token only to the configured instance", tokens)
+	}
+
+	u, _ := url.Parse(srv.URL)
+	GitLabTokens[u.Host] = "per-host"
+	defer delete(GitLabTokens, u.Host)
+	if c := other.withBaseURL(srv.URL); c.Token != "per-host" {
+		t.Errorf("got token %q from GitLabTokens", c.Token)
+	}
+}
+
+func TestGitLabAssetClientSendsTokenToInstanceOnly(t *testing.T) {
+	var instanceToken, storageToken string
+	storage := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		storageToken = r.Header.Get("PRIVATE-TOKEN")
+		w.Write([]byte("AppImage"))
+	}))
+	defer storage.Close()
+	instance := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		instanceToken = r.Header.Get("PRIVATE-TOKEN")
+		http.Redirect(w, r, storage.URL+"/App.AppImage", http.StatusFound)
+	}))
+	defer instance.Close()
+
+	client := (&GitLabClient{BaseURL: instance.URL, Token: "secret"}).assetClient()
+	resp, err := client.Get(instance.URL + "/group/project/-/releases/v1.0/downloads/App.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if instanceToken != "secret" || storageToken != "" {
+		t.Errorf("token sent to the instance %q and to the storage %q", instanceToken, storageToken)
+	}
+}
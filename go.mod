@@ -5,9 +5,12 @@ go 1.15
 require (
 	github.com/adrg/xdg v0.2.2
 	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/klauspost/compress v1.11.7
 	github.com/niemeyer/pretty v0.0.0-20200227124842-a10e7caefd8e // indirect
 	github.com/smartystreets/goconvey v1.6.4 // indirect
+	github.com/ulikunitz/xz v0.5.10
 	go.lsp.dev/uri v0.3.0
+	golang.org/x/crypto v0.0.0-20201221181555-eec23a3978ad
 	gopkg.in/check.v1 v1.0.0-20200902074654-038fdea0a05b // indirect
 	gopkg.in/ini.v1 v1.62.0
 )
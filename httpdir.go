@@ -0,0 +1,106 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Directory indexes are limited to this size, they are only a list of links
+const maxDirectoryIndexSize = 16 << 20
+
+var hrefRegexp = regexp.MustCompile(`(?i)href\s*=\s*["']([^"'#]+)["']`)
+
+// DirectoryIndexClient reads HTML directory indexes such as the ones of nginx autoindex or Apache mod_autoindex.
+// The directory URLs are absolute, so unlike the release API clients it has no BaseURL.
+type DirectoryIndexClient struct {
+	HTTPClient *http.Client
+}
+
+// DefaultDirectoryIndexClient is used to resolve http-directory-* update information
+var DefaultDirectoryIndexClient = &DirectoryIndexClient{}
+
+func (c *DirectoryIndexClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// List returns the URLs of the files the directory index at dirURL links to, in the order they appear.
+// Links leaving the directory, e.g., to the parent or to sorting options, are left out.
+func (c *DirectoryIndexClient) List(dirURL string) ([]*url.URL, error) {
+	base, err := url.Parse(dirURL)
+	if err != nil {
+		return nil, err
+	}
+	// Links in the index are relative to the directory itself
+	if !strings.HasSuffix(base.Path, "/") {
+		base.Path += "/"
+	}
+	resp, err := c.httpClient().Get(base.String())
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", base, resp.Status)
+	}
+	page, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxDirectoryIndexSize))
+	if err != nil {
+		return nil, err
+	}
+	var files []*url.URL
+	for _, m := range hrefRegexp.FindAllSubmatch(page, -1) {
+		ref, err := url.Parse(html.UnescapeString(string(m[1])))
+		if err != nil || ref.RawQuery != "" {
+			continue
+		}
+		u := base.ResolveReference(ref)
+		if u.Host != base.Host || path.Dir(u.Path) != path.Clean(base.Path) || strings.HasSuffix(u.Path, "/") {
+			continue
+		}
+		files = append(files, u)
+	}
+	return files, nil
+}
+
+// FindNewestFile returns the file whose name matches pattern, see MatchUpdateFilename,
+// and contains the highest version according to CompareVersions
+func FindNewestFile(files []*url.URL, pattern string) (*url.URL, error) {
+	var newest *url.URL
+	for _, u := range files {
+		name := path.Base(u.Path)
+		ok, err := MatchUpdateFilename(pattern, name)
+		if err != nil {
+			return nil, err
+		}
+		if ok && (newest == nil || CompareVersions(name, path.Base(newest.Path)) > 0) {
+			newest = u
+		}
+	}
+	if newest == nil {
+		return nil, errors.New("no file matching " + pattern)
+	}
+	return newest, nil
+}
+
+// resolveDirectoryIndex returns where to download the newest file http-directory-* update information points to
+func (ui UpdateInformation) resolveDirectoryIndex(c *DirectoryIndexClient, zsync bool) (UpdateTarget, error) {
+	files, err := c.List(ui.field(0))
+	if err != nil {
+		return UpdateTarget{}, err
+	}
+	newest, err := FindNewestFile(files, ui.field(1))
+	if err != nil {
+		return UpdateTarget{}, errors.New(err.Error() + " in " + ui.field(0))
+	}
+	return UpdateTarget{URL: newest.String(), Zsync: zsync, Client: c.HTTPClient}, nil
+}
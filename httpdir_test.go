@@ -0,0 +1,59 @@
+package goappimage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"testing"
+)
+
+const testDirectoryIndex = `<html><body><h1>Index of /releases/</h1>
+<a href="?C=M;O=A">Last modified</a>
+<a href="../">../</a>
+<a href="old/">old/</a>
+<a href="App-1.9-x86_64.AppImage">App-1.9-x86_64.AppImage</a>
+<a href="App-1.10-x86_64.AppImage">App-1.10-x86_64.AppImage</a>
+<a href='App-1.10-x86_64.AppImage.zsync'>App-1.10-x86_64.AppImage.zsync</a>
+<a href="https://elsewhere.example.com/releases/App-2.0-x86_64.AppImage">mirror</a>
+<a href="/other/App-3.0-x86_64.AppImage">other</a>
+</body></html>`
+
+func TestDirectoryIndexClient(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/releases/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(testDirectoryIndex))
+	}))
+	defer srv.Close()
+	c := &DirectoryIndexClient{HTTPClient: srv.Client()}
+
+	files, err := c.List(srv.URL + "/releases")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, path.Base(f.Path))
+	}
+	if len(names) != 3 || names[0] != "App-1.9-x86_64.AppImage" || names[2] != "App-1.10-x86_64.AppImage.zsync" {
+		t.Errorf("unexpected files %v", names)
+	}
+
+	ui, err := ParseUpdateInformation("http-directory-direct|" + srv.URL + "/releases/|App-*-x86_64.AppImage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	target, err := ui.resolveDirectoryIndex(c, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if target.URL != srv.URL+"/releases/App-1.10-x86_64.AppImage" || target.Client != c.HTTPClient {
+		t.Errorf("resolved to %+v", target)
+	}
+
+	if _, err = c.List(srv.URL + "/missing/"); err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,228 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+
+	"github.com/CalebQ42/GoAppImage/internal/zsync"
+	"golang.org/x/crypto/openpgp"
+)
+
+// Suffixes of the files Update keeps next to the AppImage it updates
+const (
+	PartialSuffix  = ".part"
+	PreviousSuffix = ".zs-old"
+)
+
+// Errors returned by Update and Rollback
+var (
+	ErrNotTrusted = errors.New("AppImage is not signed by a trusted key")
+	ErrNoRollback = errors.New("there is no previous version to roll back to")
+)
+
+// UpdateOptions configure how Update verifies the new version of an AppImage
+type UpdateOptions struct {
+	// If set, the new version has to be signed by one of these keys
+	TrustedKeys openpgp.EntityList
+	// If set, the signing key is pinned on first use and has to match afterwards, see KeyStore.CheckUpdate.
+	// Newly pinned keys are saved.
+	KeyStore *KeyStore
+	// Reject new versions that are not validly signed, even if neither TrustedKeys nor KeyStore are set
+	RequireSignature bool
+	// If set, receives the progress of the update
+	Progress ProgressFunc
+}
+
+// Update replaces the AppImage with the version its update information points to.
+// The new version is downloaded, with zsync if the transport mechanism uses it, to a .part file
+// next to the AppImage, verified, given the permissions and owner of the AppImage, and then renamed over it,
+// so that the path always holds a complete AppImage. The version it replaced is kept as a .zs-old file for Rollback.
+// The AppImage is left as it was if anything fails. An interrupted download is kept as the .part file
+// and resumed by the next Update, while a download that fails verification, be it against the SHA-1
+// of the .zsync file or in the checks of opts, is removed.
+func Update(ai AppImage, opts UpdateOptions) (AppImage, error) {
+	if ai.UpdateInformation.IsZero() {
+		return ai, errors.New(ai.Path + " has no update information")
+	}
+	p := newProgressReporter(opts.Progress)
+	p.enter(PhaseResolve)
+	target, err := ai.UpdateInformation.ResolveURL()
+	if err != nil {
+		return ai, err
+	}
+	part := ai.Path + PartialSuffix
+	if target.Zsync {
+		_, err = ai.zsyncDownload(target.httpClient(), target.URL, part, p)
+	} else {
+		p.enter(PhaseDownload)
+		err = downloadPart(target.httpClient(), target.URL, part, p)
+	}
+	if errors.Is(err, zsync.ErrSHA1Mismatch) {
+		os.Remove(part)
+	}
+	if err != nil {
+		return ai, err
+	}
+	err = installUpdate(ai, part, opts, p)
+	if err != nil {
+		os.Remove(part)
+		return ai, err
+	}
+	return NewAppImage(ai.Path), nil
+}
+
+// installUpdate verifies the downloaded update at part and moves it in place of current
+func installUpdate(current AppImage, part string, opts UpdateOptions, p *progressReporter) error {
+	p.enter(PhaseVerify)
+	update := openAppImage(part)
+	if update.ImageType < 1 {
+		return errors.New(part + " is not a valid AppImage")
+	}
+	err := verifyUpdate(current, update, opts)
+	if err != nil {
+		return err
+	}
+	p.enter(PhaseInstall)
+	err = copyPermissions(current.Path, part)
+	if err != nil {
+		return err
+	}
+	err = syncFile(part)
+	if err != nil {
+		return err
+	}
+	err = keepPreviousVersion(current.Path)
+	if err != nil {
+		return err
+	}
+	// rename replaces the old version atomically, there is no moment without an AppImage at the path
+	return os.Rename(part, current.Path)
+}
+
+// verifyUpdate checks the embedded digest and the signature of update. An invalid signature is always rejected,
+// a missing one only if opts ask for a signature.
+// Content downloaded with zsync has already been checked against the SHA-1 of the .zsync file.
+func verifyUpdate(current AppImage, update AppImage, opts UpdateOptions) error {
+	ok, err := update.VerifyMD5Digest()
+	if err != nil && !errors.Is(err, ErrNoDigest) {
+		return err
+	}
+	if err == nil && !ok {
+		return errors.New(update.Path + " does not match its embedded MD5 digest")
+	}
+	// A signature that does not match is rejected whether or not opts ask for one,
+	// it means that the update has been tampered with
+	res, err := update.VerifySignature(opts.TrustedKeys)
+	if err != nil {
+		return err
+	}
+	if !res.Valid && (res.Signed || opts.RequireSignature || opts.TrustedKeys != nil) {
+		return fmt.Errorf("%w: %s: %s", ErrNotSigned, update.Path, res.Reason)
+	}
+	if opts.TrustedKeys != nil && !res.Trusted {
+		return fmt.Errorf("%w: %s is signed by %s", ErrNotTrusted, update.Path, res.Fingerprint)
+	}
+	if opts.KeyStore != nil {
+		_, err = opts.KeyStore.CheckUpdate(current, update)
+		if err != nil {
+			return err
+		}
+		return opts.KeyStore.Save()
+	}
+	return nil
+}
+
+// copyPermissions gives dst the mode and owner of src. The exec bit is always set.
+func copyPermissions(src string, dst string) error {
+	info, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(dst, info.Mode().Perm()|0111)
+	if err != nil {
+		return err
+	}
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return os.Chown(dst, int(st.Uid), int(st.Gid))
+	}
+	return nil
+}
+
+func syncFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	f.Close()
+	return err
+}
+
+// keepPreviousVersion makes path available as path + PreviousSuffix without moving it away.
+// A hard link is used where possible, a copy otherwise.
+func keepPreviousVersion(path string) error {
+	previous := path + PreviousSuffix
+	err := os.Remove(previous)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if os.Link(path, previous) == nil {
+		return nil
+	}
+	err = copyFile(path, previous)
+	if err != nil {
+		os.Remove(previous)
+	}
+	return err
+}
+
+func copyFile(src string, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return copyPermissions(src, dst)
+}
+
+// Rollback restores the version of the AppImage that the last Update replaced.
+// The current version is discarded. Returns ErrNoRollback if there is no previous version.
+func Rollback(ai AppImage) (AppImage, error) {
+	previous := ai.Path + PreviousSuffix
+	_, err := os.Stat(previous)
+	if os.IsNotExist(err) {
+		return ai, fmt.Errorf("%w: %s", ErrNoRollback, ai.Path)
+	}
+	if err != nil {
+		return ai, err
+	}
+	if openAppImage(previous).ImageType < 1 {
+		return ai, errors.New(previous + " is not a valid AppImage")
+	}
+	err = os.Rename(previous, ai.Path)
+	if err != nil {
+		return ai, err
+	}
+	return NewAppImage(ai.Path), nil
+}
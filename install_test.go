@@ -0,0 +1,176 @@
+package goappimage
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/packet"
+)
+
+// newTestEntity returns a new key pair. The key is small so that the tests do not spend their time generating it.
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{RSABits: 1024})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// writeSignableAppImage writes an AppImage with the sections the runtime reserves for signing,
+// as large as the runtime makes them, and returns it as opened by NewAppImage. It is large enough
+// not to be dismissed as too small to be an AppImage.
+// version ends up in the payload, so that AppImages of different versions differ.
+func writeSignableAppImage(t *testing.T, version byte) AppImage {
+	t.Helper()
+	payload := testSquashfs(128 << 10)
+	payload[4096] = version
+	path, _ := writeTestELF(t, []testSection{
+		{name: ".sha256_sig", data: make([]byte, 1024)},
+		{name: ".sig_key", data: make([]byte, 8192)},
+	}, payload)
+	ai := openAppImage(path)
+	if ai.ImageType != 2 {
+		t.Fatalf("%s is not a type-2 AppImage", path)
+	}
+	return ai
+}
+
+// signedAppImage returns the contents of a signed AppImage of version
+func signedAppImage(t *testing.T, signer *openpgp.Entity, version byte) []byte {
+	t.Helper()
+	ai := writeSignableAppImage(t, version)
+	if signer != nil {
+		if err := ai.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	data, err := ioutil.ReadFile(ai.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// serveUpdate serves update as the new version of ai, which gets update information that points to it
+func serveUpdate(t *testing.T, ai *AppImage, update []byte) {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(update)
+	}))
+	t.Cleanup(srv.Close)
+	ai.UpdateInformation = UpdateInformation{Transport: "test-kv", Fields: []string{srv.URL, "App.AppImage"}}
+}
+
+func TestUpdateInstallsAndRollsBack(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	current := writeSignableAppImage(t, 1)
+	if err := os.Chmod(current.Path, 0750); err != nil {
+		t.Fatal(err)
+	}
+	old, err := ioutil.ReadFile(current.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := signedAppImage(t, signer, 2)
+	serveUpdate(t, &current, update)
+
+	var phases []UpdatePhase
+	updated, err := Update(current, UpdateOptions{
+		TrustedKeys: openpgp.EntityList{signer},
+		Progress: func(p Progress) {
+			if len(phases) == 0 || phases[len(phases)-1] != p.Phase {
+				phases = append(phases, p.Phase)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.ImageType != 2 {
+		t.Errorf("the updated AppImage is of type %d", updated.ImageType)
+	}
+	if data, err := ioutil.ReadFile(current.Path); err != nil || !bytes.Equal(data, update) {
+		t.Errorf("the update was not installed: %v", err)
+	}
+	info, err := os.Stat(current.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0751 {
+		t.Errorf("the update has mode %v, want the mode of the AppImage with the exec bit", info.Mode().Perm())
+	}
+	if _, err := os.Stat(current.Path + PartialSuffix); !os.IsNotExist(err) {
+		t.Errorf("%s is left behind: %v", PartialSuffix, err)
+	}
+	want := []UpdatePhase{PhaseResolve, PhaseDownload, PhaseVerify, PhaseInstall}
+	if len(phases) != len(want) {
+		t.Errorf("phases %v, want %v", phases, want)
+	} else {
+		for i := range want {
+			if phases[i] != want[i] {
+				t.Errorf("phases %v, want %v", phases, want)
+				break
+			}
+		}
+	}
+
+	if data, err := ioutil.ReadFile(current.Path + PreviousSuffix); err != nil || !bytes.Equal(data, old) {
+		t.Fatalf("the previous version was not kept: %v", err)
+	}
+	if _, err := Rollback(updated); err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(current.Path); err != nil || !bytes.Equal(data, old) {
+		t.Errorf("Rollback did not restore the previous version: %v", err)
+	}
+	if _, err := os.Stat(current.Path + PreviousSuffix); !os.IsNotExist(err) {
+		t.Errorf("%s is left behind: %v", PreviousSuffix, err)
+	}
+	if _, err := Rollback(updated); !errors.Is(err, ErrNoRollback) {
+		t.Errorf("expected ErrNoRollback, got %v", err)
+	}
+}
+
+func TestUpdateRejectsUnverifiedUpdates(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	other := newTestEntity(t, "other")
+	tampered := signedAppImage(t, signer, 2)
+	tampered[len(tampered)-1] ^= 0xff
+	tests := []struct {
+		name   string
+		update []byte
+		opts   UpdateOptions
+		err    error
+	}{
+		{"tampered", tampered, UpdateOptions{}, ErrNotSigned},
+		{"unsigned", signedAppImage(t, nil, 2), UpdateOptions{RequireSignature: true}, ErrNotSigned},
+		{"untrusted", signedAppImage(t, other, 2), UpdateOptions{TrustedKeys: openpgp.EntityList{signer}}, ErrNotTrusted},
+	}
+	for _, tt := range tests {
+		current := writeSignableAppImage(t, 1)
+		old, err := ioutil.ReadFile(current.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serveUpdate(t, &current, tt.update)
+		_, err = Update(current, tt.opts)
+		if !errors.Is(err, tt.err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.err, err)
+		}
+		if data, err := ioutil.ReadFile(current.Path); err != nil || !bytes.Equal(data, old) {
+			t.Errorf("%s: the AppImage was changed: %v", tt.name, err)
+		}
+		for _, suffix := range []string{PartialSuffix, PreviousSuffix} {
+			if _, err := os.Stat(current.Path + suffix); !os.IsNotExist(err) {
+				t.Errorf("%s: %s is left behind: %v", tt.name, suffix, err)
+			}
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"debug/elf"
 	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
 	"log"
@@ -15,36 +16,32 @@ import (
 // We need this because we rewrite Exec= to include things like wrap and Firejail
 const ExecLocationKey = "X-ExecLocation"
 
-// CalculateElfSize returns the size of an ELF binary as an int64 based on the information in the ELF header
-func CalculateElfSize(file string) int64 {
+// CalculateElfSize returns the size of an ELF binary as an int64 based on the information in the ELF header.
+// Note that this is only where the payload starts if the section header table is the last thing in the runtime,
+// use FindPayloadOffset to get a validated offset
+func CalculateElfSize(file string) (int64, error) {
 
 	// Open given elf file
 
 	f, err := os.Open(file)
-	PrintError("ioReader", err)
-	// defer f.Close()
 	if err != nil {
-		return 0
-	}
-
-	_, err = f.Stat()
-	PrintError("ioReader", err)
-	if err != nil {
-		return 0
+		return 0, err
 	}
+	defer f.Close()
+	return calculateElfSize(f)
+}
 
+func calculateElfSize(f io.ReaderAt) (int64, error) {
 	e, err := elf.NewFile(f)
 	if err != nil {
-		PrintError("elfsize elf.NewFile", err)
-		return 0
+		return 0, err
 	}
 
 	// Read identifier
 	var ident [16]uint8
 	_, err = f.ReadAt(ident[0:], 0)
 	if err != nil {
-		PrintError("elfsize read identifier", err)
-		return 0
+		return 0, err
 	}
 
 	// Decode identifier
@@ -52,55 +49,44 @@ func CalculateElfSize(file string) int64 {
 		ident[1] != 'E' ||
 		ident[2] != 'L' ||
 		ident[3] != 'F' {
-		log.Printf("Bad magic number at %d\n", ident[0:4])
-		return 0
+		return 0, fmt.Errorf("bad magic number %x", ident[0:4])
 	}
 
 	// Process by architecture
 	sr := io.NewSectionReader(f, 0, 1<<63-1)
 	var shoff, shentsize, shnum int64
-	switch e.Class.String() {
-	case "ELFCLASS64":
+	switch e.Class {
+	case elf.ELFCLASS64:
 		hdr := new(elf.Header64)
-		_, err = sr.Seek(0, 0)
-		if err != nil {
-			PrintError("elfsize", err)
-			return 0
-		}
 		err = binary.Read(sr, e.ByteOrder, hdr)
 		if err != nil {
-			PrintError("elfsize", err)
-			return 0
+			return 0, err
 		}
-
 		shoff = int64(hdr.Shoff)
 		shnum = int64(hdr.Shnum)
 		shentsize = int64(hdr.Shentsize)
-	case "ELFCLASS32":
+	case elf.ELFCLASS32:
 		hdr := new(elf.Header32)
-		_, err = sr.Seek(0, 0)
-		if err != nil {
-			PrintError("elfsize", err)
-			return 0
-		}
 		err = binary.Read(sr, e.ByteOrder, hdr)
 		if err != nil {
-			PrintError("elfsize", err)
-			return 0
+			return 0, err
 		}
-
 		shoff = int64(hdr.Shoff)
 		shnum = int64(hdr.Shnum)
 		shentsize = int64(hdr.Shentsize)
 	default:
-		log.Println("unsupported elf architecture")
-		return 0
+		return 0, errors.New("unsupported elf architecture")
+	}
+
+	// A missing or stripped section header table leaves us with nothing to calculate from
+	if shoff == 0 || shnum == 0 {
+		return 0, errors.New("no section header table")
 	}
 
 	// Calculate ELF size
 	elfsize := shoff + (shentsize * shnum)
 	// log.Println("elfsize:", elfsize, file)
-	return elfsize
+	return elfsize, nil
 }
 
 // Return true if magic string (hex) is found at offset
@@ -136,28 +122,6 @@ func PrintError(context string, e error) {
 	}
 }
 
-// GetSectionData returns the contents of an ELF section and error
-func GetSectionData(filepath string, name string) ([]byte, error) {
-	// fmt.Println("GetSectionData for '" + name + "'")
-	r, err := os.Open(filepath)
-	if err == nil {
-		defer r.Close()
-	}
-	f, err := elf.NewFile(r)
-	if err != nil {
-		return nil, err
-	}
-	section := f.Section(name)
-	if section == nil {
-		return nil, nil
-	}
-	data, err := section.Data()
-	if err != nil {
-		return nil, err
-	}
-	return data, nil
-}
-
 // FindMostRecentFile returns the most recent file
 // from a slice of files, (currently) based on its mtime
 // based on https://stackoverflow.com/a/45579190
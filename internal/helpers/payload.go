@@ -0,0 +1,270 @@
+package helpers
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ErrNoPayload is returned when no filesystem image can be found after the runtime
+var ErrNoPayload = errors.New("no filesystem image found after the runtime")
+
+// Runtimes are a few hundred KiB, so this is more than enough to find the payload
+// when neither the section header table nor the program headers point at it
+const maxPayloadScan = 16 * 1024 * 1024
+
+// Filesystem image formats that can follow the runtime
+const (
+	PayloadSquashfs = "squashfs"
+	PayloadDwarfs   = "dwarfs"
+	PayloadISO9660  = "iso9660"
+)
+
+// SquashfsMagic is the magic at the start of a squashfs superblock
+var SquashfsMagic = []byte("hsqs")
+
+// DwarfsMagic is the magic at the start of every DwarFS section header,
+// followed by a major and a minor format version byte
+var DwarfsMagic = []byte("DWARFS")
+
+// SquashfsSuperblock holds the parts of a squashfs superblock we are interested in,
+// https://dr-emann.github.io/squashfs/#superblock
+type SquashfsSuperblock struct {
+	Magic        [4]byte
+	InodeCount   uint32
+	ModTime      uint32
+	BlockSize    uint32
+	FragCount    uint32
+	Compression  uint16
+	BlockLog     uint16
+	Flags        uint16
+	IDCount      uint16
+	VersionMajor uint16
+	VersionMinor uint16
+	RootInode    uint64
+	BytesUsed    uint64
+}
+
+// ReadSquashfsSuperblock reads and sanity checks the squashfs superblock at offset
+func ReadSquashfsSuperblock(r io.ReaderAt, offset int64) (SquashfsSuperblock, error) {
+	var sb SquashfsSuperblock
+	err := binary.Read(io.NewSectionReader(r, offset, int64(binary.Size(sb))), binary.LittleEndian, &sb)
+	if err != nil {
+		return sb, err
+	}
+	if !bytes.Equal(sb.Magic[:], SquashfsMagic) {
+		return sb, errors.New("bad squashfs magic")
+	}
+	if sb.VersionMajor != 4 ||
+		sb.BlockLog < 12 || sb.BlockLog > 20 ||
+		sb.BlockSize != 1<<sb.BlockLog ||
+		sb.Compression < 1 || sb.Compression > 6 {
+		return sb, errors.New("implausible squashfs superblock")
+	}
+	return sb, nil
+}
+
+// IsDwarfsAt returns true if a DwarFS image starts at offset.
+// Only format version 2 is recognized, the one DwarfsImageSize can walk.
+func IsDwarfsAt(r io.ReaderAt, offset int64) bool {
+	hdr := make([]byte, len(DwarfsMagic)+2)
+	_, err := r.ReadAt(hdr, offset)
+	if err != nil {
+		return false
+	}
+	return bytes.Equal(hdr[:len(DwarfsMagic)], DwarfsMagic) && hdr[len(DwarfsMagic)] == 2
+}
+
+// PayloadProbe describes how to recognize a filesystem image format after the runtime
+type PayloadProbe struct {
+	Format string
+	// Magic is searched for when the offset of the payload has to be found by scanning
+	Magic []byte
+	// Probe returns true if an image of Format starts at offset
+	Probe func(r io.ReaderAt, offset int64) bool
+}
+
+// PayloadFormatAt returns the format of the first of probes that finds a filesystem image at offset,
+// or an empty string if none does
+func PayloadFormatAt(r io.ReaderAt, offset int64, probes []PayloadProbe) string {
+	for _, p := range probes {
+		if p.Probe != nil && p.Probe(r, offset) {
+			return p.Format
+		}
+	}
+	return ""
+}
+
+// IsPayloadAt returns true if one of probes finds a filesystem image at offset
+func IsPayloadAt(r io.ReaderAt, offset int64, probes []PayloadProbe) bool {
+	return PayloadFormatAt(r, offset, probes) != ""
+}
+
+// FindPayloadOffset returns the offset of the filesystem image appended to the runtime.
+// The size calculated from the ELF header is tried first, then the end of the program segments,
+// and finally aligned offsets after the ELF header are scanned for the magic of each of probes.
+// Each candidate is validated by probes before it is returned.
+func FindPayloadOffset(file string, probes []PayloadProbe) (int64, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	for _, c := range PayloadOffsetCandidates(f) {
+		if IsPayloadAt(f, c, probes) {
+			return c, nil
+		}
+	}
+
+	return scanForPayload(f, probes)
+}
+
+// PayloadOffsetCandidates returns where the payload starts according to the ELF headers of the runtime:
+// the size calculated from the ELF header, and the end of the program segments.
+// Only the headers are read, not the runtime as a whole.
+func PayloadOffsetCandidates(r io.ReaderAt) []int64 {
+	var candidates []int64
+	if elfsize, err := calculateElfSize(r); err == nil && elfsize > 0 {
+		candidates = append(candidates, elfsize)
+	}
+	if e, err := elf.NewFile(r); err == nil {
+		var end int64
+		for _, p := range e.Progs {
+			if int64(p.Off+p.Filesz) > end {
+				end = int64(p.Off + p.Filesz)
+			}
+		}
+		if end > 0 {
+			candidates = append(candidates, end)
+		}
+	}
+	return candidates
+}
+
+// scanForPayload looks for the magic of each of probes at 4-byte aligned offsets,
+// which covers padding between the runtime and the payload.
+// The first image found wins, since a DwarFS image may well contain a squashfs magic and vice versa
+func scanForPayload(f *os.File, probes []PayloadProbe) (int64, error) {
+	buf := make([]byte, maxPayloadScan)
+	n, err := f.ReadAt(buf, 0)
+	if err != nil && err != io.EOF {
+		return 0, err
+	}
+	buf = buf[:n]
+	// Skip the ELF header
+	found := -1
+	for _, p := range probes {
+		if len(p.Magic) == 0 || p.Probe == nil {
+			continue
+		}
+		for off := 64; off < len(buf); {
+			i := bytes.Index(buf[off:], p.Magic)
+			if i < 0 {
+				break
+			}
+			off += i
+			if found >= 0 && off >= found {
+				break
+			}
+			if off%4 == 0 && p.Probe(f, int64(off)) {
+				found = off
+				break
+			}
+			off++
+		}
+	}
+	if found < 0 {
+		return 0, ErrNoPayload
+	}
+	return int64(found), nil
+}
+
+// IsSquashfsAt returns true if a plausible squashfs superblock starts at offset
+func IsSquashfsAt(r io.ReaderAt, offset int64) bool {
+	_, err := ReadSquashfsSuperblock(r, offset)
+	return err == nil
+}
+
+// ISO9660VolumeDescriptor holds the parts of the ISO9660 primary volume descriptor we are interested in
+type ISO9660VolumeDescriptor struct {
+	VolumeSize   int64 // In bytes
+	CreationTime time.Time
+	ModTime      time.Time
+}
+
+// ReadISO9660VolumeDescriptor reads the primary volume descriptor of the ISO9660 image at offset,
+// https://wiki.osdev.org/ISO_9660#The_Primary_Volume_Descriptor
+func ReadISO9660VolumeDescriptor(r io.ReaderAt, offset int64) (ISO9660VolumeDescriptor, error) {
+	var vd ISO9660VolumeDescriptor
+	pvd := make([]byte, 2048)
+	_, err := r.ReadAt(pvd, offset+32768)
+	if err != nil {
+		return vd, err
+	}
+	if pvd[0] != 1 || string(pvd[1:6]) != "CD001" {
+		return vd, errors.New("no ISO9660 primary volume descriptor")
+	}
+	blocks := binary.LittleEndian.Uint32(pvd[80:84])
+	blockSize := binary.LittleEndian.Uint16(pvd[128:130])
+	vd.VolumeSize = int64(blocks) * int64(blockSize)
+	vd.CreationTime = parseISO9660Time(pvd[813:830])
+	vd.ModTime = parseISO9660Time(pvd[830:847])
+	return vd, nil
+}
+
+// parseISO9660Time parses the 17 byte "YYYYMMDDHHMMSScc" date format followed by
+// the offset from GMT in 15 minute intervals. Unset dates are returned as the zero time.
+func parseISO9660Time(b []byte) time.Time {
+	t, err := time.Parse("20060102150405", string(b[:14]))
+	if err != nil {
+		return time.Time{}
+	}
+	centis, _ := strconv.Atoi(string(b[14:16]))
+	zone := time.FixedZone("", int(int8(b[16]))*15*60)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), centis*int(time.Millisecond)*10, zone)
+}
+
+// DwarFS section headers are 64 bytes: magic, major, minor, SHA-512/256 of the section,
+// XXH3-64 of the section, section number, section type, compression and length of the section data
+const dwarfsSectionHeaderSize = 64
+
+// DwarfsImageSize walks the sections of the DwarFS image at offset and returns the size of the image.
+// An error is returned if a section header is damaged or a section extends beyond fileSize.
+func DwarfsImageSize(r io.ReaderAt, offset int64, fileSize int64) (int64, error) {
+	hdr := make([]byte, dwarfsSectionHeaderSize)
+	pos := offset
+	for pos < fileSize {
+		if pos+dwarfsSectionHeaderSize > fileSize {
+			return 0, io.ErrUnexpectedEOF
+		}
+		_, err := r.ReadAt(hdr, pos)
+		if err != nil {
+			return 0, err
+		}
+		if !bytes.Equal(hdr[:len(DwarfsMagic)], DwarfsMagic) || hdr[len(DwarfsMagic)] != 2 {
+			if pos == offset {
+				return 0, errors.New("no DwarFS v2 image")
+			}
+			// Whatever follows the last section is not part of the image
+			break
+		}
+		// The length is not to be trusted, a huge one would wrap pos around
+		length := binary.LittleEndian.Uint64(hdr[56:64])
+		if length > math.MaxInt64 {
+			return 0, fmt.Errorf("damaged DwarFS section header at %d", pos)
+		}
+		if length > uint64(fileSize-pos-dwarfsSectionHeaderSize) {
+			return 0, io.ErrUnexpectedEOF
+		}
+		pos += dwarfsSectionHeaderSize + int64(length)
+	}
+	return pos - offset, nil
+}
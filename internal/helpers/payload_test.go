@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+// dwarfsSection returns a DwarFS v2 section header claiming length bytes of data, followed by data
+func dwarfsSection(major byte, length uint64, data []byte) []byte {
+	hdr := make([]byte, dwarfsSectionHeaderSize)
+	copy(hdr, DwarfsMagic)
+	hdr[len(DwarfsMagic)] = major
+	binary.LittleEndian.PutUint64(hdr[56:], length)
+	return append(hdr, data...)
+}
+
+func TestDwarfsImageSize(t *testing.T) {
+	image := append(dwarfsSection(2, 10, make([]byte, 10)), dwarfsSection(2, 3, []byte("abc"))...)
+	file := append(append([]byte("runtime!"), image...), make([]byte, dwarfsSectionHeaderSize)...)
+	size, err := DwarfsImageSize(bytes.NewReader(file), 8, int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size != int64(len(image)) {
+		t.Errorf("size %d, want %d", size, len(image))
+	}
+	if !IsDwarfsAt(bytes.NewReader(file), 8) {
+		t.Error("DwarFS v2 image not recognized")
+	}
+}
+
+func TestDwarfsImageSizeRejectsCraftedLengths(t *testing.T) {
+	tests := []struct {
+		name   string
+		length uint64
+		want   error
+	}{
+		{"wraps to -64", 0xFFFFFFFFFFFFFFC0, nil},
+		{"negative", 1 << 63, nil},
+		{"past the end of the file", 100, io.ErrUnexpectedEOF},
+		{"one byte too long", 11, io.ErrUnexpectedEOF},
+	}
+	for _, tt := range tests {
+		file := dwarfsSection(2, tt.length, make([]byte, 10))
+		_, err := DwarfsImageSize(bytes.NewReader(file), 0, int64(len(file)))
+		if err == nil {
+			t.Errorf("%s: expected an error", tt.name)
+		} else if tt.want != nil && !errors.Is(err, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, err, tt.want)
+		}
+	}
+}
+
+func TestIsDwarfsAtAgreesWithDwarfsImageSize(t *testing.T) {
+	file := dwarfsSection(1, 0, nil)
+	if IsDwarfsAt(bytes.NewReader(file), 0) {
+		t.Error("DwarFS v1 image recognized, but its size cannot be determined")
+	}
+	if _, err := DwarfsImageSize(bytes.NewReader(file), 0, int64(len(file))); err == nil {
+		t.Error("expected an error for a DwarFS v1 image")
+	}
+}
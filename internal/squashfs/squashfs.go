@@ -0,0 +1,672 @@
+// Package squashfs reads files from squashfs 4.0 images through an io.ReaderAt.
+// Only the parts of the image that are needed are read, which makes it usable for images
+// that are read with HTTP range requests, https://dr-emann.github.io/squashfs/
+package squashfs
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const (
+	metadataBlockSize = 8192
+	// Fragment entries are kept in metadata blocks, 512 of them in each
+	fragmentEntrySize = 16
+	noFragment        = 0xffffffff
+	// Set in the size of a data block that is stored uncompressed
+	uncompressedBlock = 1 << 24
+	// Longer symlink targets are not accepted, Linux does not allow them either
+	maxSymlinkTarget = 4096
+)
+
+// Compression ids of the superblock
+const (
+	compressionGzip = 1
+	compressionXz   = 4
+	compressionZstd = 6
+)
+
+// Inode types
+const (
+	typeDir         = 1
+	typeFile        = 2
+	typeSymlink     = 3
+	typeBlockDev    = 4
+	typeCharDev     = 5
+	typeFifo        = 6
+	typeSocket      = 7
+	typeExtDir      = 8
+	typeExtFile     = 9
+	typeExtSymlink  = 10
+	typeExtBlockDev = 11
+	typeExtCharDev  = 12
+	typeExtFifo     = 13
+	typeExtSocket   = 14
+)
+
+type superblock struct {
+	Magic               [4]byte
+	InodeCount          uint32
+	ModTime             uint32
+	BlockSize           uint32
+	FragCount           uint32
+	Compression         uint16
+	BlockLog            uint16
+	Flags               uint16
+	IDCount             uint16
+	VersionMajor        uint16
+	VersionMinor        uint16
+	RootInode           uint64
+	BytesUsed           uint64
+	IDTableStart        uint64
+	XattrIDTableStart   uint64
+	InodeTableStart     uint64
+	DirectoryTableStart uint64
+	FragmentTableStart  uint64
+	ExportTableStart    uint64
+}
+
+type metadataBlock struct {
+	data []byte
+	next int64
+}
+
+// Reader reads a squashfs image. It is not safe for concurrent use.
+type Reader struct {
+	r        io.ReaderAt
+	offset   int64
+	sb       superblock
+	metadata map[int64]metadataBlock // Metadata blocks by position, they are read again and again
+	// The fragment block read last, many small files share one
+	fragmentIndex uint32
+	fragment      []byte
+}
+
+// Open reads the superblock of the squashfs image at offset in r
+func Open(r io.ReaderAt, offset int64) (*Reader, error) {
+	fs := &Reader{r: r, offset: offset, metadata: make(map[int64]metadataBlock), fragmentIndex: noFragment}
+	err := binary.Read(io.NewSectionReader(r, offset, int64(binary.Size(fs.sb))), binary.LittleEndian, &fs.sb)
+	if err != nil {
+		return nil, err
+	}
+	if string(fs.sb.Magic[:]) != "hsqs" {
+		return nil, errors.New("squashfs: bad magic")
+	}
+	if fs.sb.VersionMajor != 4 || fs.sb.BlockLog < 12 || fs.sb.BlockLog > 20 || fs.sb.BlockSize != 1<<fs.sb.BlockLog {
+		return nil, errors.New("squashfs: implausible superblock")
+	}
+	switch fs.sb.Compression {
+	case compressionGzip, compressionXz, compressionZstd:
+	default:
+		return nil, fmt.Errorf("squashfs: compression %d is not supported", fs.sb.Compression)
+	}
+	return fs, nil
+}
+
+// ModTime returns when the image was made
+func (fs *Reader) ModTime() time.Time {
+	return time.Unix(int64(fs.sb.ModTime), 0)
+}
+
+// Size returns the number of bytes used by the image
+func (fs *Reader) Size() int64 {
+	return int64(fs.sb.BytesUsed)
+}
+
+// readAt reads len(p) bytes at pos, relative to the start of the image, which must not go beyond its end
+func (fs *Reader) readAt(p []byte, pos int64) error {
+	if pos < 0 || pos+int64(len(p)) > int64(fs.sb.BytesUsed) {
+		return fmt.Errorf("squashfs: %d bytes at %d are beyond the end of the image", len(p), pos)
+	}
+	_, err := fs.r.ReadAt(p, fs.offset+pos)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// decompress decompresses a block that decompresses to at most limit bytes
+func (fs *Reader) decompress(data []byte, limit int) ([]byte, error) {
+	var r io.Reader
+	switch fs.sb.Compression {
+	case compressionGzip:
+		zr, err := zlib.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	case compressionXz:
+		xr, err := xz.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+		r = xr
+	case compressionZstd:
+		zr, err := zstd.NewReader(bytes.NewReader(data), zstd.WithDecoderConcurrency(1))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		r = zr
+	}
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out) > limit {
+		return nil, errors.New("squashfs: block decompresses to more than its maximum size")
+	}
+	return out, nil
+}
+
+// metadataBlock returns the contents of the metadata block at pos, relative to the start of the image
+func (fs *Reader) metadataBlock(pos int64) (metadataBlock, error) {
+	if b, ok := fs.metadata[pos]; ok {
+		return b, nil
+	}
+	var hdr [2]byte
+	err := fs.readAt(hdr[:], pos)
+	if err != nil {
+		return metadataBlock{}, err
+	}
+	// The upper bit is set for blocks that are stored uncompressed
+	size := binary.LittleEndian.Uint16(hdr[:])
+	data := make([]byte, size&0x7fff)
+	err = fs.readAt(data, pos+2)
+	if err != nil {
+		return metadataBlock{}, err
+	}
+	b := metadataBlock{data: data, next: pos + 2 + int64(len(data))}
+	if size&0x8000 == 0 {
+		b.data, err = fs.decompress(data, metadataBlockSize)
+		if err != nil {
+			return metadataBlock{}, err
+		}
+	} else if len(data) > metadataBlockSize {
+		return metadataBlock{}, errors.New("squashfs: oversized metadata block")
+	}
+	fs.metadata[pos] = b
+	return b, nil
+}
+
+// metadataReader reads the metadata that starts in the block at tableStart plus the upper bits of ref,
+// at the offset in the lower 16 bits of ref, continuing into the blocks after it
+type metadataReader struct {
+	fs   *Reader
+	data []byte
+	next int64
+}
+
+func (fs *Reader) metadataReader(tableStart int64, ref uint64) (*metadataReader, error) {
+	b, err := fs.metadataBlock(tableStart + int64(ref>>16))
+	if err != nil {
+		return nil, err
+	}
+	offset := int(ref & 0xffff)
+	if offset > len(b.data) {
+		return nil, errors.New("squashfs: metadata reference beyond the end of its block")
+	}
+	return &metadataReader{fs: fs, data: b.data[offset:], next: b.next}, nil
+}
+
+func (m *metadataReader) Read(p []byte) (int, error) {
+	for len(m.data) == 0 {
+		b, err := m.fs.metadataBlock(m.next)
+		if err != nil {
+			return 0, err
+		}
+		m.data, m.next = b.data, b.next
+	}
+	n := copy(p, m.data)
+	m.data = m.data[n:]
+	return n, nil
+}
+
+type inode struct {
+	typ     uint16
+	mode    os.FileMode
+	modTime time.Time
+	// Directories
+	dirBlock  uint32
+	dirOffset uint16
+	dirSize   uint32
+	// Regular files
+	size       int64
+	blockStart int64
+	blockSizes []uint32
+	fragment   uint32
+	fragOffset uint32
+	// Symlinks
+	target string
+}
+
+type inodeHeader struct {
+	Type        uint16
+	Permissions uint16
+	UID         uint16
+	GID         uint16
+	ModTime     uint32
+	InodeNumber uint32
+}
+
+// inode reads the inode ref points to
+func (fs *Reader) inode(ref uint64) (*inode, error) {
+	m, err := fs.metadataReader(int64(fs.sb.InodeTableStart), ref)
+	if err != nil {
+		return nil, err
+	}
+	var hdr inodeHeader
+	err = binary.Read(m, binary.LittleEndian, &hdr)
+	if err != nil {
+		return nil, err
+	}
+	in := &inode{typ: hdr.Type, mode: os.FileMode(hdr.Permissions & 0777), modTime: time.Unix(int64(hdr.ModTime), 0)}
+	switch hdr.Type {
+	case typeDir:
+		var d struct {
+			BlockIndex  uint32
+			LinkCount   uint32
+			FileSize    uint16
+			BlockOffset uint16
+			Parent      uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &d)
+		in.mode |= os.ModeDir
+		in.dirBlock, in.dirOffset, in.dirSize = d.BlockIndex, d.BlockOffset, uint32(d.FileSize)
+	case typeExtDir:
+		var d struct {
+			LinkCount   uint32
+			FileSize    uint32
+			BlockIndex  uint32
+			Parent      uint32
+			IndexCount  uint16
+			BlockOffset uint16
+			XattrIndex  uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &d)
+		in.mode |= os.ModeDir
+		in.dirBlock, in.dirOffset, in.dirSize = d.BlockIndex, d.BlockOffset, d.FileSize
+	case typeFile:
+		var f struct {
+			BlockStart uint32
+			Fragment   uint32
+			FragOffset uint32
+			FileSize   uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &f)
+		in.blockStart, in.fragment, in.fragOffset, in.size = int64(f.BlockStart), f.Fragment, f.FragOffset, int64(f.FileSize)
+	case typeExtFile:
+		var f struct {
+			BlockStart uint64
+			FileSize   uint64
+			Sparse     uint64
+			LinkCount  uint32
+			Fragment   uint32
+			FragOffset uint32
+			XattrIndex uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &f)
+		if f.BlockStart > fs.sb.BytesUsed || f.FileSize > 1<<62 {
+			return nil, errors.New("squashfs: damaged file inode")
+		}
+		in.blockStart, in.fragment, in.fragOffset, in.size = int64(f.BlockStart), f.Fragment, f.FragOffset, int64(f.FileSize)
+	case typeSymlink, typeExtSymlink:
+		var s struct {
+			LinkCount  uint32
+			TargetSize uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &s)
+		if err == nil && s.TargetSize > maxSymlinkTarget {
+			return nil, errors.New("squashfs: symlink target too long")
+		}
+		if err == nil {
+			target := make([]byte, s.TargetSize)
+			_, err = io.ReadFull(m, target)
+			in.target = string(target)
+		}
+		in.mode |= os.ModeSymlink
+	case typeBlockDev, typeExtBlockDev:
+		in.mode |= os.ModeDevice
+	case typeCharDev, typeExtCharDev:
+		in.mode |= os.ModeDevice | os.ModeCharDevice
+	case typeFifo, typeExtFifo:
+		in.mode |= os.ModeNamedPipe
+	case typeSocket, typeExtSocket:
+		in.mode |= os.ModeSocket
+	default:
+		return nil, fmt.Errorf("squashfs: unknown inode type %d", hdr.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if in.typ == typeFile || in.typ == typeExtFile {
+		err = fs.readBlockSizes(m, in)
+	}
+	return in, err
+}
+
+// readBlockSizes reads the list of data block sizes that follows a file inode
+func (fs *Reader) readBlockSizes(m io.Reader, in *inode) error {
+	bs := int64(fs.sb.BlockSize)
+	n := in.size / bs
+	if in.fragment == noFragment && in.size%bs != 0 {
+		n++
+	}
+	// Each block takes 4 bytes of the image, so a damaged inode cannot make us allocate more than that
+	if n*4 > int64(fs.sb.BytesUsed) {
+		return errors.New("squashfs: damaged file inode")
+	}
+	in.blockSizes = make([]uint32, n)
+	return binary.Read(m, binary.LittleEndian, in.blockSizes)
+}
+
+type dirEntry struct {
+	name string
+	ref  uint64
+}
+
+// readDir reads the entries of the directory in
+func (fs *Reader) readDir(in *inode) ([]dirEntry, error) {
+	// The size includes the . and .. entries, which are not stored
+	remaining := int64(in.dirSize) - 3
+	if remaining <= 0 {
+		return nil, nil
+	}
+	m, err := fs.metadataReader(int64(fs.sb.DirectoryTableStart), uint64(in.dirBlock)<<16|uint64(in.dirOffset))
+	if err != nil {
+		return nil, err
+	}
+	var entries []dirEntry
+	for remaining > 0 {
+		var hdr struct {
+			Count       uint32
+			Start       uint32
+			InodeNumber uint32
+		}
+		err = binary.Read(m, binary.LittleEndian, &hdr)
+		if err != nil {
+			return nil, err
+		}
+		remaining -= 12
+		if hdr.Count >= 256 {
+			return nil, errors.New("squashfs: damaged directory")
+		}
+		for i := uint32(0); i <= hdr.Count; i++ {
+			var e struct {
+				Offset      uint16
+				InodeOffset int16
+				Type        uint16
+				NameSize    uint16
+			}
+			err = binary.Read(m, binary.LittleEndian, &e)
+			if err != nil {
+				return nil, err
+			}
+			if e.NameSize >= 256 {
+				return nil, errors.New("squashfs: damaged directory")
+			}
+			name := make([]byte, int(e.NameSize)+1)
+			_, err = io.ReadFull(m, name)
+			if err != nil {
+				return nil, err
+			}
+			remaining -= 8 + int64(len(name))
+			entries = append(entries, dirEntry{name: string(name), ref: uint64(hdr.Start)<<16 | uint64(e.Offset)})
+		}
+	}
+	if remaining != 0 {
+		return nil, errors.New("squashfs: damaged directory")
+	}
+	return entries, nil
+}
+
+// cleanName returns name relative to the root of the image, "" for the root itself
+func cleanName(name string) string {
+	return strings.TrimPrefix(path.Clean("/"+name), "/")
+}
+
+// lookup returns the inode of the named file. Symlinks are not followed.
+func (fs *Reader) lookup(op string, name string) (*inode, error) {
+	in, err := fs.inode(fs.sb.RootInode)
+	if err != nil {
+		return nil, err
+	}
+	name = cleanName(name)
+	if name == "" {
+		return in, nil
+	}
+	for _, component := range strings.Split(name, "/") {
+		if !in.mode.IsDir() {
+			return nil, &os.PathError{Op: op, Path: name, Err: syscall.ENOTDIR}
+		}
+		entries, err := fs.readDir(in)
+		if err != nil {
+			return nil, err
+		}
+		var ref uint64
+		found := false
+		for _, e := range entries {
+			if e.name == component {
+				ref, found = e.ref, true
+				break
+			}
+		}
+		if !found {
+			return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+		}
+		in, err = fs.inode(ref)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return in, nil
+}
+
+type fileInfo struct {
+	name string
+	in   *inode
+}
+
+func (fi fileInfo) Name() string       { return fi.name }
+func (fi fileInfo) Size() int64        { return fi.in.size }
+func (fi fileInfo) Mode() os.FileMode  { return fi.in.mode }
+func (fi fileInfo) ModTime() time.Time { return fi.in.modTime }
+func (fi fileInfo) IsDir() bool        { return fi.in.mode.IsDir() }
+func (fi fileInfo) Sys() interface{}   { return nil }
+
+// Stat returns information about the named file without following symlinks
+func (fs *Reader) Stat(name string) (os.FileInfo, error) {
+	in, err := fs.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return fileInfo{name: path.Base("/" + cleanName(name)), in: in}, nil
+}
+
+// ReadDir returns the entries of the named directory, sorted by name
+func (fs *Reader) ReadDir(name string) ([]os.FileInfo, error) {
+	in, err := fs.lookup("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	if !in.mode.IsDir() {
+		return nil, &os.PathError{Op: "readdir", Path: name, Err: syscall.ENOTDIR}
+	}
+	entries, err := fs.readDir(in)
+	if err != nil {
+		return nil, err
+	}
+	infos := make([]os.FileInfo, 0, len(entries))
+	for _, e := range entries {
+		child, err := fs.inode(e.ref)
+		if err != nil {
+			return nil, err
+		}
+		infos = append(infos, fileInfo{name: e.name, in: child})
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// Readlink returns the target of the named symlink
+func (fs *Reader) Readlink(name string) (string, error) {
+	in, err := fs.lookup("readlink", name)
+	if err != nil {
+		return "", err
+	}
+	if in.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: syscall.EINVAL}
+	}
+	return in.target, nil
+}
+
+// Open opens the named regular file for reading
+func (fs *Reader) Open(name string) (io.ReadCloser, error) {
+	in, err := fs.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !in.mode.IsRegular() {
+		return nil, &os.PathError{Op: "open", Path: name, Err: errors.New("not a regular file")}
+	}
+	return &fileReader{fs: fs, in: in, pos: in.blockStart, remaining: in.size}, nil
+}
+
+// dataBlock reads the data block of size, as given in the block list of an inode, at pos
+func (fs *Reader) dataBlock(pos int64, size uint32) ([]byte, error) {
+	data := make([]byte, size&^uncompressedBlock)
+	if len(data) > int(fs.sb.BlockSize) {
+		return nil, errors.New("squashfs: oversized data block")
+	}
+	err := fs.readAt(data, pos)
+	if err != nil {
+		return nil, err
+	}
+	if size&uncompressedBlock != 0 {
+		return data, nil
+	}
+	return fs.decompress(data, int(fs.sb.BlockSize))
+}
+
+// fragmentBlock returns the contents of the fragment block with index
+func (fs *Reader) fragmentBlock(index uint32) ([]byte, error) {
+	if index == fs.fragmentIndex {
+		return fs.fragment, nil
+	}
+	if index >= fs.sb.FragCount {
+		return nil, errors.New("squashfs: fragment index out of range")
+	}
+	// The fragment table is a list of the positions of the metadata blocks holding the entries
+	var ptr [8]byte
+	err := fs.readAt(ptr[:], int64(fs.sb.FragmentTableStart)+8*int64(index/(metadataBlockSize/fragmentEntrySize)))
+	if err != nil {
+		return nil, err
+	}
+	offset := uint64(index%(metadataBlockSize/fragmentEntrySize)) * fragmentEntrySize
+	m, err := fs.metadataReader(int64(binary.LittleEndian.Uint64(ptr[:])), offset)
+	if err != nil {
+		return nil, err
+	}
+	var e struct {
+		Start  uint64
+		Size   uint32
+		Unused uint32
+	}
+	err = binary.Read(m, binary.LittleEndian, &e)
+	if err != nil {
+		return nil, err
+	}
+	if e.Start > fs.sb.BytesUsed {
+		return nil, errors.New("squashfs: damaged fragment entry")
+	}
+	data, err := fs.dataBlock(int64(e.Start), e.Size)
+	if err != nil {
+		return nil, err
+	}
+	fs.fragmentIndex, fs.fragment = index, data
+	return data, nil
+}
+
+// fileReader reads a regular file block by block, the end of it possibly from a fragment block
+type fileReader struct {
+	fs           *Reader
+	in           *inode
+	block        int
+	pos          int64
+	remaining    int64
+	fragmentRead bool
+	buf          []byte
+}
+
+func (f *fileReader) Read(p []byte) (int, error) {
+	for len(f.buf) == 0 {
+		if f.remaining == 0 {
+			return 0, io.EOF
+		}
+		data, err := f.next()
+		if err != nil {
+			return 0, err
+		}
+		if int64(len(data)) > f.remaining {
+			data = data[:f.remaining]
+		}
+		f.remaining -= int64(len(data))
+		f.buf = data
+	}
+	n := copy(p, f.buf)
+	f.buf = f.buf[n:]
+	return n, nil
+}
+
+// next returns the contents of the next block of the file
+func (f *fileReader) next() ([]byte, error) {
+	bs := int64(f.fs.sb.BlockSize)
+	if f.block < len(f.in.blockSizes) {
+		size := f.in.blockSizes[f.block]
+		f.block++
+		if size == 0 {
+			// A sparse block, which is not stored at all
+			if f.remaining < bs {
+				return make([]byte, f.remaining), nil
+			}
+			return make([]byte, bs), nil
+		}
+		data, err := f.fs.dataBlock(f.pos, size)
+		f.pos += int64(size &^ uncompressedBlock)
+		if err == nil && int64(len(data)) < bs && f.remaining > int64(len(data)) {
+			err = errors.New("squashfs: short data block")
+		}
+		return data, err
+	}
+	if f.in.fragment == noFragment || f.fragmentRead {
+		return nil, io.ErrUnexpectedEOF
+	}
+	f.fragmentRead = true
+	data, err := f.fs.fragmentBlock(f.in.fragment)
+	if err != nil {
+		return nil, err
+	}
+	if int64(f.in.fragOffset)+f.remaining > int64(len(data)) {
+		return nil, errors.New("squashfs: damaged fragment reference")
+	}
+	return data[f.in.fragOffset:], nil
+}
+
+func (f *fileReader) Close() error {
+	return nil
+}
@@ -0,0 +1,186 @@
+package squashfs
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/CalebQ42/GoAppImage/internal/squashfs/squashfstest"
+)
+
+// testTree returns a directory tree with files of the sizes that matter:
+// whole blocks, a tail in a fragment, sparse blocks, empty files and more entries than fit into one header
+func testTree(many int) *squashfstest.File {
+	appdata := bytes.Repeat([]byte("<component/>\n"), 800) // 2 blocks and a tail
+	sparse := append(make([]byte, 2*4096), "end"...)
+	usr := &squashfstest.File{Name: "usr", Dir: true, Children: []*squashfstest.File{
+		{Name: "share", Dir: true, Children: []*squashfstest.File{
+			{Name: "metainfo", Dir: true, Children: []*squashfstest.File{
+				{Name: "org.example.App.appdata.xml", Data: appdata},
+			}},
+		}},
+		{Name: "lib", Dir: true, Extended: true, Children: []*squashfstest.File{
+			{Name: "sparse", Data: sparse, Extended: true},
+			{Name: "empty"},
+		}},
+	}}
+	root := &squashfstest.File{Dir: true, Children: []*squashfstest.File{
+		usr,
+		{Name: "AppRun", Data: []byte("#!/bin/sh\n")},
+		{Name: "link", Target: "usr/share"},
+		{Name: "extlink", Target: "usr/lib", Extended: true},
+	}}
+	if many > 0 {
+		dir := &squashfstest.File{Name: "many", Dir: true}
+		for i := 0; i < many; i++ {
+			dir.Children = append(dir.Children, &squashfstest.File{Name: fmt.Sprintf("file%04d", i), Data: []byte(fmt.Sprint(i))})
+		}
+		root.Children = append(root.Children, dir)
+	}
+	return root
+}
+
+func readFile(t *testing.T, fs *Reader, name string) []byte {
+	t.Helper()
+	r, err := fs.Open(name)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatalf("%s: %v", name, err)
+	}
+	return data
+}
+
+func TestReader(t *testing.T) {
+	tests := []struct {
+		name string
+		many int
+		opts squashfstest.Options
+	}{
+		{"uncompressed", 600, squashfstest.Options{ModTime: 1600000000}},
+		{"gzip", 0, squashfstest.Options{Compression: squashfstest.Gzip, ModTime: 1600000000}},
+		{"xz", 0, squashfstest.Options{Compression: squashfstest.Xz, ModTime: 1600000000}},
+		{"zstd", 0, squashfstest.Options{Compression: squashfstest.Zstd, ModTime: 1600000000}},
+	}
+	for _, tt := range tests {
+		tree := testTree(tt.many)
+		// The image does not have to start at the beginning, like the payload of an AppImage
+		prefix := []byte("runtime")
+		image := squashfstest.Build(tree, tt.opts)
+		fs, err := Open(bytes.NewReader(append(prefix, image...)), int64(len(prefix)))
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if fs.Size() != int64(len(image)) || fs.ModTime().Unix() != 1600000000 {
+			t.Errorf("%s: size %d, time %v", tt.name, fs.Size(), fs.ModTime())
+		}
+
+		usr := tree.Children[0]
+		want := usr.Children[0].Children[0].Children[0].Data
+		if got := readFile(t, fs, "usr/share/metainfo/org.example.App.appdata.xml"); !bytes.Equal(got, want) {
+			t.Errorf("%s: appdata has %d bytes, want %d", tt.name, len(got), len(want))
+		}
+		if got := readFile(t, fs, "/usr/lib/../lib/sparse"); !bytes.Equal(got, usr.Children[1].Children[0].Data) {
+			t.Errorf("%s: sparse file differs", tt.name)
+		}
+		if got := readFile(t, fs, "usr/lib/empty"); len(got) != 0 {
+			t.Errorf("%s: empty file has %d bytes", tt.name, len(got))
+		}
+		if got := readFile(t, fs, "AppRun"); string(got) != "#!/bin/sh\n" {
+			t.Errorf("%s: AppRun is %q", tt.name, got)
+		}
+
+		infos, err := fs.ReadDir("")
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		var names []string
+		for _, info := range infos {
+			names = append(names, info.Name())
+		}
+		wantNames := "[AppRun extlink link usr]"
+		if tt.many > 0 {
+			wantNames = "[AppRun extlink link many usr]"
+		}
+		if fmt.Sprint(names) != wantNames {
+			t.Errorf("%s: root has %v", tt.name, names)
+		}
+		info, err := fs.Stat("usr/lib/sparse")
+		if err != nil || info.Size() != int64(len(usr.Children[1].Children[0].Data)) || !info.Mode().IsRegular() || info.Mode().Perm() != 0644 {
+			t.Errorf("%s: Stat sparse: %v, %v", tt.name, info, err)
+		}
+		if info, err = fs.Stat("usr/lib"); err != nil || !info.IsDir() || info.Name() != "lib" {
+			t.Errorf("%s: Stat lib: %v, %v", tt.name, info, err)
+		}
+		for name, target := range map[string]string{"link": "usr/share", "extlink": "usr/lib"} {
+			info, err = fs.Stat(name)
+			if err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("%s: Stat %s: %v, %v", tt.name, name, info, err)
+			}
+			if got, err := fs.Readlink(name); err != nil || got != target {
+				t.Errorf("%s: %s points to %q, %v", tt.name, name, got, err)
+			}
+		}
+
+		// Symlinks are not followed, and errors are like those of the os package
+		if _, err = fs.Open("link/metainfo/org.example.App.appdata.xml"); err == nil {
+			t.Errorf("%s: opened a file through a symlink", tt.name)
+		}
+		if _, err = fs.Open("usr/nothing"); !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("%s: expected a not exist error, got %v", tt.name, err)
+		}
+		if _, err = fs.Open("usr"); err == nil {
+			t.Errorf("%s: opened a directory", tt.name)
+		}
+		if _, err = fs.Readlink("AppRun"); err == nil {
+			t.Errorf("%s: Readlink of a regular file", tt.name)
+		}
+
+		if tt.many > 0 {
+			infos, err = fs.ReadDir("many")
+			if err != nil || len(infos) != tt.many {
+				t.Fatalf("%s: many has %d entries, %v", tt.name, len(infos), err)
+			}
+			for _, i := range []int{0, 255, 256, tt.many - 1} {
+				name := fmt.Sprintf("many/file%04d", i)
+				if got := readFile(t, fs, name); string(got) != fmt.Sprint(i) {
+					t.Errorf("%s: %s is %q", tt.name, name, got)
+				}
+			}
+		}
+	}
+}
+
+func TestReaderRejectsDamagedImages(t *testing.T) {
+	image := squashfstest.Build(testTree(300), squashfstest.Options{})
+	// Cut short anywhere, nothing is to panic and the files that can be read are right
+	for n := 0; n < len(image); n += 97 {
+		fs, err := Open(bytes.NewReader(image[:n]), 0)
+		if err != nil {
+			continue
+		}
+		for _, name := range []string{"usr/share/metainfo/org.example.App.appdata.xml", "many/file0299", "usr/lib/sparse"} {
+			r, err := fs.Open(name)
+			if err != nil {
+				continue
+			}
+			ioutil.ReadAll(r)
+		}
+		fs.ReadDir("many")
+	}
+
+	if _, err := Open(bytes.NewReader(make([]byte, 96)), 0); err == nil {
+		t.Error("expected an error for an image without magic")
+	}
+	unsupported := append([]byte{}, image...)
+	unsupported[20] = 3 // LZO
+	if _, err := Open(bytes.NewReader(unsupported), 0); err == nil {
+		t.Error("expected an error for an unsupported compression")
+	}
+}
@@ -0,0 +1,292 @@
+// Package squashfstest builds small squashfs images for tests, without needing mksquashfs
+package squashfstest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"io"
+	"sort"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+const metadataBlockSize = 8192
+
+// File is a file of an image made by Build. Files with Dir set are directories, files with a Target symlinks,
+// everything else regular files. Extended makes Build use the extended inode type for the file.
+type File struct {
+	Name     string
+	Dir      bool
+	Children []*File
+	Target   string
+	Data     []byte
+	Extended bool
+}
+
+// Compression ids of the superblock
+const (
+	Gzip = 1
+	Xz   = 4
+	Zstd = 6
+)
+
+// Options configure Build
+type Options struct {
+	BlockLog int // log2 of the block size, 12 if 0
+	// Compression of all blocks, 0 to store them uncompressed. Compressed images only work
+	// if their tables fit into one metadata block.
+	Compression uint16
+	ModTime     uint32
+}
+
+type builder struct {
+	opts      Options
+	blockSize int
+	image     bytes.Buffer
+	inodes    bytes.Buffer
+	dirs      bytes.Buffer
+	fragment  []byte
+	fragments [][2]uint64 // start and size field of each fragment block
+	count     uint32
+}
+
+// Build returns a squashfs image of root, which has to be a directory
+func Build(root *File, opts Options) []byte {
+	if opts.BlockLog == 0 {
+		opts.BlockLog = 12
+	}
+	b := &builder{opts: opts, blockSize: 1 << opts.BlockLog}
+	b.image.Write(make([]byte, 96))
+	rootRef, _ := b.add(root)
+	b.flushFragment()
+
+	inodeTable := b.writeMetadata(b.inodes.Bytes())
+	dirTable := b.writeMetadata(b.dirs.Bytes())
+	var entries bytes.Buffer
+	for _, f := range b.fragments {
+		binary.Write(&entries, binary.LittleEndian, f[0])
+		binary.Write(&entries, binary.LittleEndian, uint32(f[1]))
+		binary.Write(&entries, binary.LittleEndian, uint32(0))
+	}
+	fragmentTable := uint64(0xffffffffffffffff)
+	if len(b.fragments) > 0 {
+		fragmentTable = b.writeLookupTable(entries.Bytes())
+	}
+	idTable := b.writeLookupTable(make([]byte, 4))
+
+	compression := opts.Compression
+	if compression == 0 {
+		compression = Gzip
+	}
+	sb := []interface{}{
+		[]byte("hsqs"), b.count, opts.ModTime, uint32(b.blockSize), uint32(len(b.fragments)),
+		compression, uint16(opts.BlockLog), uint16(0), uint16(1), uint16(4), uint16(0),
+		rootRef, uint64(b.image.Len()), idTable, uint64(0xffffffffffffffff),
+		inodeTable, dirTable, fragmentTable, uint64(0xffffffffffffffff),
+	}
+	var hdr bytes.Buffer
+	for _, v := range sb {
+		binary.Write(&hdr, binary.LittleEndian, v)
+	}
+	image := b.image.Bytes()
+	copy(image, hdr.Bytes())
+	return image
+}
+
+// ref returns the reference to pos in a metadata stream, as it ends up in the table written by writeMetadata
+func (b *builder) ref(pos int) uint64 {
+	if b.opts.Compression != 0 {
+		if pos >= metadataBlockSize {
+			panic("squashfstest: compressed tables have to fit into one metadata block")
+		}
+		return uint64(pos)
+	}
+	return uint64(pos/metadataBlockSize*(metadataBlockSize+2))<<16 | uint64(pos%metadataBlockSize)
+}
+
+func (b *builder) compress(data []byte) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch b.opts.Compression {
+	case Gzip:
+		w = zlib.NewWriter(&buf)
+	case Xz:
+		w, _ = xz.NewWriter(&buf)
+	case Zstd:
+		w, _ = zstd.NewWriter(&buf)
+	default:
+		panic("squashfstest: unknown compression")
+	}
+	w.Write(data)
+	w.Close()
+	return buf.Bytes()
+}
+
+// writeMetadata writes data as metadata blocks and returns where they start
+func (b *builder) writeMetadata(data []byte) uint64 {
+	start := uint64(b.image.Len())
+	for len(data) > 0 {
+		n := len(data)
+		if n > metadataBlockSize {
+			n = metadataBlockSize
+		}
+		block := data[:n]
+		size := uint16(n) | 0x8000
+		if b.opts.Compression != 0 {
+			block = b.compress(block)
+			size = uint16(len(block))
+		}
+		binary.Write(&b.image, binary.LittleEndian, size)
+		b.image.Write(block)
+		data = data[n:]
+	}
+	return start
+}
+
+// writeLookupTable writes data as metadata blocks followed by the list of their positions,
+// and returns where the list starts
+func (b *builder) writeLookupTable(data []byte) uint64 {
+	var positions []uint64
+	for len(data) > 0 {
+		n := len(data)
+		if n > metadataBlockSize {
+			n = metadataBlockSize
+		}
+		positions = append(positions, b.writeMetadata(data[:n]))
+		data = data[n:]
+	}
+	start := uint64(b.image.Len())
+	binary.Write(&b.image, binary.LittleEndian, positions)
+	return start
+}
+
+// writeBlock writes a data block and returns the size field for it
+func (b *builder) writeBlock(data []byte) uint32 {
+	if b.opts.Compression != 0 {
+		data = b.compress(data)
+		b.image.Write(data)
+		return uint32(len(data))
+	}
+	b.image.Write(data)
+	return uint32(len(data)) | 1<<24
+}
+
+func (b *builder) flushFragment() {
+	if len(b.fragment) == 0 {
+		return
+	}
+	start := uint64(b.image.Len())
+	size := b.writeBlock(b.fragment)
+	b.fragments = append(b.fragments, [2]uint64{start, uint64(size)})
+	b.fragment = nil
+}
+
+func (b *builder) header(typ uint16, perm uint16) {
+	b.count++
+	binary.Write(&b.inodes, binary.LittleEndian, []uint16{typ, perm, 0, 0})
+	binary.Write(&b.inodes, binary.LittleEndian, []uint32{b.opts.ModTime, b.count})
+}
+
+// add writes f and everything in it, and returns the reference to its inode and its basic inode type
+func (b *builder) add(f *File) (uint64, uint16) {
+	switch {
+	case f.Dir:
+		return b.addDir(f)
+	case f.Target != "":
+		ref := b.ref(b.inodes.Len())
+		typ := uint16(3)
+		if f.Extended {
+			typ = 10
+		}
+		b.header(typ, 0777)
+		binary.Write(&b.inodes, binary.LittleEndian, []uint32{1, uint32(len(f.Target))})
+		b.inodes.WriteString(f.Target)
+		if f.Extended {
+			binary.Write(&b.inodes, binary.LittleEndian, uint32(0xffffffff))
+		}
+		return ref, 3
+	}
+	return b.addFile(f), 2
+}
+
+func (b *builder) addFile(f *File) uint64 {
+	start := uint64(b.image.Len())
+	var sizes []uint32
+	data := f.Data
+	for len(data) >= b.blockSize {
+		if bytes.Count(data[:b.blockSize], []byte{0}) == b.blockSize {
+			sizes = append(sizes, 0) // Sparse
+		} else {
+			sizes = append(sizes, b.writeBlock(data[:b.blockSize]))
+		}
+		data = data[b.blockSize:]
+	}
+	fragment, fragOffset := uint32(0xffffffff), uint32(0)
+	if len(data) > 0 {
+		if len(b.fragment)+len(data) > b.blockSize {
+			b.flushFragment()
+		}
+		fragment, fragOffset = uint32(len(b.fragments)), uint32(len(b.fragment))
+		b.fragment = append(b.fragment, data...)
+	}
+
+	ref := b.ref(b.inodes.Len())
+	if f.Extended {
+		b.header(9, 0644)
+		binary.Write(&b.inodes, binary.LittleEndian, []uint64{start, uint64(len(f.Data)), 0})
+		binary.Write(&b.inodes, binary.LittleEndian, []uint32{1, fragment, fragOffset, 0xffffffff})
+	} else {
+		b.header(2, 0644)
+		binary.Write(&b.inodes, binary.LittleEndian, []uint32{uint32(start), fragment, fragOffset, uint32(len(f.Data))})
+	}
+	binary.Write(&b.inodes, binary.LittleEndian, sizes)
+	return ref
+}
+
+func (b *builder) addDir(f *File) (uint64, uint16) {
+	children := append([]*File{}, f.Children...)
+	sort.Slice(children, func(i, j int) bool { return children[i].Name < children[j].Name })
+	type entry struct {
+		name string
+		ref  uint64
+		typ  uint16
+	}
+	var entries []entry
+	for _, c := range children {
+		ref, typ := b.add(c)
+		entries = append(entries, entry{c.Name, ref, typ})
+	}
+
+	listing := b.dirs.Len()
+	for len(entries) > 0 {
+		// Entries under one header have their inodes in the same metadata block, and there are at most 256
+		n := 1
+		for n < len(entries) && n < 256 && entries[n].ref>>16 == entries[0].ref>>16 {
+			n++
+		}
+		binary.Write(&b.dirs, binary.LittleEndian, []uint32{uint32(n - 1), uint32(entries[0].ref >> 16), 1})
+		for _, e := range entries[:n] {
+			binary.Write(&b.dirs, binary.LittleEndian, []uint16{uint16(e.ref), 0, e.typ, uint16(len(e.name) - 1)})
+			b.dirs.WriteString(e.name)
+		}
+		entries = entries[n:]
+	}
+	size := b.dirs.Len() - listing + 3
+	dirRef := b.ref(listing)
+
+	ref := b.ref(b.inodes.Len())
+	if f.Extended {
+		b.header(8, 0755)
+		binary.Write(&b.inodes, binary.LittleEndian, []uint32{2, uint32(size), uint32(dirRef >> 16), 0})
+		binary.Write(&b.inodes, binary.LittleEndian, []uint16{0, uint16(dirRef)})
+		binary.Write(&b.inodes, binary.LittleEndian, uint32(0xffffffff))
+	} else {
+		b.header(1, 0755)
+		binary.Write(&b.inodes, binary.LittleEndian, []uint32{uint32(dirRef >> 16), 2})
+		binary.Write(&b.inodes, binary.LittleEndian, []uint16{uint16(size), uint16(dirRef)})
+		binary.Write(&b.inodes, binary.LittleEndian, uint32(0))
+	}
+	return ref, 1
+}
@@ -0,0 +1,149 @@
+// Package zsync implements a zsync client, which downloads only those parts of a file
+// that cannot be found in a local (older) version of it, http://zsync.moria.org.uk/
+package zsync
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limits for the header of a .zsync file, which come from the network and are not to be trusted
+const (
+	MaxBlocksize = 16 << 20
+	MaxLength    = 1 << 40
+	// Block numbers have to fit into an int everywhere
+	maxBlocks = math.MaxInt32
+)
+
+// ControlFile is a parsed .zsync file
+type ControlFile struct {
+	Version       string
+	Filename      string
+	MTime         time.Time
+	Blocksize     int
+	Length        int64
+	SeqMatches    int // Number of consecutive blocks that have to match
+	RsumBytes     int // Number of bytes of the rolling checksum per block
+	ChecksumBytes int // Number of bytes of the MD4 checksum per block
+	URLs          []string
+	SHA1          string // Hex encoded
+
+	blocks []blockSum
+}
+
+type blockSum struct {
+	rsum     uint32 // Masked to RsumBytes
+	checksum []byte
+}
+
+// Blocks returns the number of blocks the target file consists of
+func (c *ControlFile) Blocks() int {
+	return int((c.Length + int64(c.Blocksize) - 1) / int64(c.Blocksize))
+}
+
+// ParseHeader parses only the header of a .zsync file, which is all that is needed
+// to compare the target file with a local one
+func ParseHeader(r io.Reader) (*ControlFile, error) {
+	return parseHeader(bufio.NewReader(r))
+}
+
+// Parse parses a .zsync file including the block checksums.
+// The checksums are read as they come rather than allocated by the header up front,
+// so that a header claiming more blocks than the file has costs no memory.
+func Parse(r io.Reader) (*ControlFile, error) {
+	br := bufio.NewReader(r)
+	c, err := parseHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	n := c.Blocks()
+	buf := make([]byte, c.RsumBytes+c.ChecksumBytes)
+	for i := 0; i < n; i++ {
+		_, err = io.ReadFull(br, buf)
+		if err != nil {
+			return nil, fmt.Errorf("zsync: reading checksums of block %d of %d: %w", i, n, err)
+		}
+		var rsum uint32
+		for _, b := range buf[:c.RsumBytes] {
+			rsum = rsum<<8 | uint32(b)
+		}
+		c.blocks = append(c.blocks, blockSum{rsum: rsum, checksum: append([]byte{}, buf[c.RsumBytes:]...)})
+	}
+	return c, nil
+}
+
+func parseHeader(br *bufio.Reader) (*ControlFile, error) {
+	c := &ControlFile{SeqMatches: 1, RsumBytes: 4, ChecksumBytes: 16}
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, errors.New("zsync: header does not end with an empty line")
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		i := strings.Index(line, ":")
+		if i < 0 {
+			return nil, errors.New("zsync: invalid header line " + line)
+		}
+		key, value := line[:i], strings.TrimSpace(line[i+1:])
+		switch key {
+		case "zsync":
+			c.Version = value
+		case "Filename":
+			c.Filename = value
+		case "MTime":
+			c.MTime, err = time.Parse(time.RFC1123Z, value)
+		case "Blocksize":
+			c.Blocksize, err = strconv.Atoi(value)
+		case "Length":
+			c.Length, err = strconv.ParseInt(value, 10, 64)
+		case "Hash-Lengths":
+			parts := strings.Split(value, ",")
+			if len(parts) != 3 {
+				return nil, errors.New("zsync: invalid Hash-Lengths " + value)
+			}
+			c.SeqMatches, err = strconv.Atoi(parts[0])
+			if err == nil {
+				c.RsumBytes, err = strconv.Atoi(parts[1])
+			}
+			if err == nil {
+				c.ChecksumBytes, err = strconv.Atoi(parts[2])
+			}
+		case "URL":
+			c.URLs = append(c.URLs, value)
+		case "SHA-1":
+			_, err = hex.DecodeString(value)
+			c.SHA1 = strings.ToLower(value)
+		case "Z-URL", "Z-Map2", "Recompress":
+			return nil, errors.New("zsync: compressed targets are not supported")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("zsync: invalid %s: %w", key, err)
+		}
+	}
+	if c.Blocksize <= 0 || c.Blocksize > MaxBlocksize || c.Blocksize&(c.Blocksize-1) != 0 {
+		return nil, fmt.Errorf("zsync: invalid Blocksize %d", c.Blocksize)
+	}
+	if c.Length < 0 || c.Length > MaxLength {
+		return nil, fmt.Errorf("zsync: invalid Length %d", c.Length)
+	}
+	if (c.Length+int64(c.Blocksize)-1)/int64(c.Blocksize) > maxBlocks {
+		return nil, fmt.Errorf("zsync: %d bytes in blocks of %d are too many blocks", c.Length, c.Blocksize)
+	}
+	if c.SeqMatches < 1 || c.SeqMatches > 2 || c.RsumBytes < 1 || c.RsumBytes > 4 || c.ChecksumBytes < 3 || c.ChecksumBytes > 16 {
+		return nil, errors.New("zsync: invalid Hash-Lengths")
+	}
+	if c.SHA1 == "" {
+		return nil, errors.New("zsync: SHA-1 is missing")
+	}
+	return c, nil
+}
@@ -0,0 +1,89 @@
+package zsync
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// makeControlFile returns a .zsync file for target, as zsyncmake would write it
+func makeControlFile(target []byte, blocksize int, fileURL string) []byte {
+	var buf bytes.Buffer
+	sum := sha1.Sum(target)
+	fmt.Fprintf(&buf, "zsync: 0.6.2\nFilename: App.AppImage\nMTime: Mon, 02 Jan 2006 15:04:05 +0000\n")
+	fmt.Fprintf(&buf, "Blocksize: %d\nLength: %d\nHash-Lengths: 2,4,16\nURL: %s\nSHA-1: %s\n\n",
+		blocksize, len(target), fileURL, hex.EncodeToString(sum[:]))
+	c := &ControlFile{RsumBytes: 4, ChecksumBytes: 16}
+	for start := 0; start < len(target); start += blocksize {
+		block := make([]byte, blocksize)
+		copy(block, target[start:])
+		a, b := rsum(block)
+		key := c.rsumKey(a, b)
+		buf.Write([]byte{byte(key >> 24), byte(key >> 16), byte(key >> 8), byte(key)})
+		buf.Write(c.checksum(block))
+	}
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	target := bytes.Repeat([]byte("0123456789"), 100)
+	c, err := Parse(bytes.NewReader(makeControlFile(target, 64, "App.AppImage")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Blocksize != 64 || c.Length != 1000 || c.SeqMatches != 2 || c.Filename != "App.AppImage" ||
+		len(c.URLs) != 1 || c.URLs[0] != "App.AppImage" || c.MTime.Year() != 2006 {
+		t.Errorf("unexpected header %+v", c)
+	}
+	if c.Blocks() != 16 || len(c.blocks) != 16 {
+		t.Errorf("got %d blocks and %d checksums, want 16", c.Blocks(), len(c.blocks))
+	}
+}
+
+func TestParseRejectsInvalidHeaders(t *testing.T) {
+	header := "zsync: 0.6.2\nBlocksize: %s\nLength: %s\nSHA-1: 0000000000000000000000000000000000000000\n\n"
+	tests := []struct{ blocksize, length string }{
+		{"0", "1024"},
+		{"1000", "1024"},
+		{"-2048", "1024"},
+		{"1073741824", "1024"},
+		{"2048", "-1"},
+		{"1", "1099511627777"},
+		{"1", "4294967296"},
+		{"x", "1024"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(strings.NewReader(fmt.Sprintf(header, tt.blocksize, tt.length)))
+		if err == nil {
+			t.Errorf("Blocksize %s, Length %s: expected an error", tt.blocksize, tt.length)
+		}
+	}
+}
+
+func TestParseDoesNotTrustTheBlockCount(t *testing.T) {
+	// A billion blocks are announced, but the checksums of only one follow
+	data := "zsync: 0.6.2\nBlocksize: 1\nLength: 1000000000\nSHA-1: 0000000000000000000000000000000000000000\n\n" +
+		strings.Repeat("x", 20)
+	_, err := Parse(strings.NewReader(data))
+	if err == nil || !strings.Contains(err.Error(), "block 1 of 1000000000") {
+		t.Errorf("expected an error for the missing checksums, got %v", err)
+	}
+}
+
+func TestParseHeader(t *testing.T) {
+	target := bytes.Repeat([]byte{1}, 5000)
+	c, err := ParseHeader(bytes.NewReader(makeControlFile(target, 2048, "https://example.com/App.AppImage")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Length != 5000 || c.blocks != nil {
+		t.Errorf("unexpected header %+v", c)
+	}
+	_, err = ParseHeader(strings.NewReader("zsync: 0.6.2\nZ-URL: App.AppImage.gz\nBlocksize: 2048\nSHA-1: 00\n\n"))
+	if err == nil {
+		t.Error("expected an error for a compressed target")
+	}
+}
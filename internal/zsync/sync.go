@@ -0,0 +1,416 @@
+package zsync
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/md4"
+)
+
+// Most servers limit the number of ranges in one request, so missing data is requested in batches
+const maxRangesPerRequest = 32
+
+// ErrSHA1Mismatch is returned by Sync and Verify if the result is not the target file
+var ErrSHA1Mismatch = errors.New("zsync: SHA-1 mismatch")
+
+// Stats tells how much of the target file was found locally and how much had to be downloaded
+type Stats struct {
+	Reused     int64
+	Downloaded int64
+}
+
+// rsum calculates the rolling checksum zsync uses for a block
+func rsum(block []byte) (uint16, uint16) {
+	var a, b uint16
+	l := uint16(len(block))
+	for i, x := range block {
+		a += uint16(x)
+		b += (l - uint16(i)) * uint16(x)
+	}
+	return a, b
+}
+
+func (c *ControlFile) rsumKey(a, b uint16) uint32 {
+	return (uint32(a)<<16 | uint32(b)) & (0xffffffff >> uint(8*(4-c.RsumBytes)))
+}
+
+func (c *ControlFile) checksum(block []byte) []byte {
+	h := md4.New()
+	h.Write(block)
+	return h.Sum(nil)[:c.ChecksumBytes]
+}
+
+// The seed is read in pieces of at least this size, so that the rolling search does not read it byte by byte
+const seedReadSize = 256 * 1024
+
+// seedWindow reads the seed through a buffer of a few blocks. The seed is padded with zero bytes beyond its end,
+// like the last block of the target file.
+type seedWindow struct {
+	r     io.ReaderAt
+	size  int64
+	start int64 // Where buf starts in the seed
+	buf   []byte
+	err   error
+}
+
+func newSeedWindow(r io.ReaderAt, size int64, bs int) *seedWindow {
+	n := 2*bs + 1
+	if n < seedReadSize {
+		n = seedReadSize
+	}
+	return &seedWindow{r: r, size: size, buf: make([]byte, 0, n)}
+}
+
+// at returns the n bytes of the seed at pos. They are valid until the next call.
+func (w *seedWindow) at(pos int64, n int) []byte {
+	if pos >= w.start && pos+int64(n) <= w.start+int64(len(w.buf)) {
+		return w.buf[pos-w.start : pos-w.start+int64(n)]
+	}
+	w.start = pos
+	w.buf = w.buf[:cap(w.buf)]
+	read := 0
+	if pos < w.size {
+		read = len(w.buf)
+		if int64(read) > w.size-pos {
+			read = int(w.size - pos)
+		}
+		if err := readSeed(w.r, w.buf[:read], pos); err != nil && w.err == nil {
+			w.err = err
+		}
+	}
+	for i := read; i < len(w.buf); i++ {
+		w.buf[i] = 0
+	}
+	return w.buf[:n]
+}
+
+// readSeed reads len(p) bytes of the seed at off. io.EOF is not an error if all of them were read.
+func readSeed(r io.ReaderAt, p []byte, off int64) error {
+	n, err := r.ReadAt(p, off)
+	if err == io.EOF && n == len(p) {
+		return nil
+	}
+	return err
+}
+
+// Concat returns parts one after another as one seed for Sync, e.g., the local AppImage and an interrupted download
+func Concat(parts ...*io.SectionReader) *io.SectionReader {
+	var size int64
+	for _, p := range parts {
+		size += p.Size()
+	}
+	return io.NewSectionReader(concatReaderAt(parts), 0, size)
+}
+
+type concatReaderAt []*io.SectionReader
+
+func (c concatReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for _, part := range c {
+		if len(p) == n {
+			break
+		}
+		if off >= part.Size() {
+			off -= part.Size()
+			continue
+		}
+		want := int64(len(p) - n)
+		if want > part.Size()-off {
+			want = part.Size() - off
+		}
+		m, err := part.ReadAt(p[n:n+int(want)], off)
+		n += m
+		if err != nil && !(err == io.EOF && int64(m) == want) {
+			return n, err
+		}
+		off = 0
+	}
+	if n < len(p) {
+		return n, io.EOF
+	}
+	return n, nil
+}
+
+// findBlocks looks for the blocks of the target file in the first size bytes of seed and returns, for each block,
+// the offset in seed at which it was found, or -1. Only a few blocks of seed are held in memory at a time.
+func (c *ControlFile) findBlocks(seed io.ReaderAt, size int64) ([]int64, error) {
+	bs := c.Blocksize
+	found := make([]int64, len(c.blocks))
+	for i := range found {
+		found[i] = -1
+	}
+	if size == 0 || len(c.blocks) == 0 {
+		return found, nil
+	}
+	index := make(map[uint32][]int)
+	for i, b := range c.blocks {
+		index[b.rsum] = append(index[b.rsum], i)
+	}
+	// Blocks at the end of the target are padded with zeros, which the window does for the seed, too
+	w := newSeedWindow(seed, size, bs)
+	bshift := uint(0)
+	for 1<<bshift < bs {
+		bshift++
+	}
+
+	matches := func(i int, pos int64) bool {
+		window := w.at(pos, bs)
+		a, b := rsum(window)
+		if c.rsumKey(a, b) != c.blocks[i].rsum {
+			return false
+		}
+		return bytes.Equal(c.checksum(window), c.blocks[i].checksum)
+	}
+
+	a, b := rsum(w.at(0, bs))
+	for pos := int64(0); pos < size; {
+		matched := false
+		for _, i := range index[c.rsumKey(a, b)] {
+			if found[i] >= 0 || !bytes.Equal(c.checksum(w.at(pos, bs)), c.blocks[i].checksum) {
+				continue
+			}
+			// Weak checksums need the following block to match, too
+			if c.SeqMatches > 1 && i+1 < len(c.blocks) && !matches(i+1, pos+int64(bs)) {
+				continue
+			}
+			found[i] = pos
+			if c.SeqMatches > 1 && i+1 < len(c.blocks) && found[i+1] < 0 {
+				found[i+1] = pos + int64(bs)
+			}
+			matched = true
+		}
+		if matched {
+			pos += int64(bs)
+			if pos < size {
+				a, b = rsum(w.at(pos, bs))
+			}
+			continue
+		}
+		// The byte leaving the window and the one entering it
+		window := w.at(pos, bs+1)
+		oldc, newc := uint16(window[0]), uint16(window[bs])
+		a += newc - oldc
+		b += a - oldc<<bshift
+		pos++
+	}
+	return found, w.err
+}
+
+// FileURL returns the URL of the target file, the URL in the control file resolved against base
+func (c *ControlFile) FileURL(base *url.URL) (string, error) {
+	if len(c.URLs) == 0 {
+		return "", errors.New("zsync: control file has no URL")
+	}
+	ref, err := url.Parse(c.URLs[0])
+	if err != nil {
+		return "", err
+	}
+	return base.ResolveReference(ref).String(), nil
+}
+
+// Sync assembles the target file in out. Blocks that can be found in the first seedSize bytes of seed
+// are taken from there, everything else is downloaded from the URL in the control file, which is relative to base.
+// The result is verified against the SHA-1 in the control file.
+// If progress is not nil, it is called whenever more of the target file is available.
+func (c *ControlFile) Sync(client *http.Client, base *url.URL, seed io.ReaderAt, seedSize int64, out *os.File, progress func(Stats)) (Stats, error) {
+	var stats Stats
+	if c.blocks == nil && c.Length > 0 {
+		return stats, errors.New("zsync: control file was parsed without block checksums")
+	}
+	fileURL, err := c.FileURL(base)
+	if err != nil {
+		return stats, err
+	}
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	found, err := c.findBlocks(seed, seedSize)
+	if err != nil {
+		return stats, err
+	}
+	bs := int64(c.Blocksize)
+	var missing [][2]int64 // [start, end) in the target file
+	for i, pos := range found {
+		start := int64(i) * bs
+		end := start + bs
+		if end > c.Length {
+			end = c.Length
+		}
+		if pos < 0 {
+			if n := len(missing); n > 0 && missing[n-1][1] == start {
+				missing[n-1][1] = end
+			} else {
+				missing = append(missing, [2]int64{start, end})
+			}
+			continue
+		}
+		block := make([]byte, end-start) // Zero padded if the block was found at the end of seed
+		if pos < seedSize {
+			n := int64(len(block))
+			if n > seedSize-pos {
+				n = seedSize - pos
+			}
+			if err = readSeed(seed, block[:n], pos); err != nil {
+				return stats, err
+			}
+		}
+		_, err = out.WriteAt(block, start)
+		if err != nil {
+			return stats, err
+		}
+		stats.Reused += end - start
+	}
+	live := stats
+	onData := func(n int64) {
+		live.Downloaded += n
+		if progress != nil {
+			progress(live)
+		}
+	}
+	if progress != nil {
+		progress(live)
+	}
+
+	for len(missing) > 0 {
+		n := len(missing)
+		if n > maxRangesPerRequest {
+			n = maxRangesPerRequest
+		}
+		downloaded, complete, err := fetchRanges(client, fileURL, missing[:n], out, onData)
+		stats.Downloaded += downloaded
+		if err != nil {
+			return stats, err
+		}
+		if complete {
+			break
+		}
+		missing = missing[n:]
+	}
+
+	err = out.Truncate(c.Length)
+	if err != nil {
+		return stats, err
+	}
+	return stats, c.Verify(out)
+}
+
+// Verify checks the SHA-1 of r against the one in the control file
+func (c *ControlFile) Verify(r io.ReaderAt) error {
+	h := sha1.New()
+	_, err := io.Copy(h, io.NewSectionReader(r, 0, c.Length))
+	if err != nil {
+		return err
+	}
+	if sum := hex.EncodeToString(h.Sum(nil)); sum != c.SHA1 {
+		return fmt.Errorf("%w, expected %s, got %s", ErrSHA1Mismatch, c.SHA1, sum)
+	}
+	return nil
+}
+
+// fetchRanges downloads the byte ranges from fileURL into out.
+// complete is true if the server sent the whole file instead, which then has been written to out as a whole.
+// onData is called with the number of bytes of every chunk received.
+func fetchRanges(client *http.Client, fileURL string, ranges [][2]int64, out io.WriterAt, onData func(int64)) (downloaded int64, complete bool, err error) {
+	specs := make([]string, len(ranges))
+	for i, r := range ranges {
+		specs[i] = strconv.FormatInt(r[0], 10) + "-" + strconv.FormatInt(r[1]-1, 10)
+	}
+	req, err := http.NewRequest(http.MethodGet, fileURL, nil)
+	if err != nil {
+		return 0, false, err
+	}
+	req.Header.Set("Range", "bytes="+strings.Join(specs, ","))
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, false, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+		// The server does not do ranges
+		n, err := io.Copy(&offsetWriter{w: out}, &countingReader{r: resp.Body, onData: onData})
+		return n, true, err
+	case http.StatusPartialContent:
+	default:
+		return 0, false, fmt.Errorf("zsync: %s: %s", fileURL, resp.Status)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "multipart/byteranges" {
+		n, err := copyContentRange(resp.Header.Get("Content-Range"), &countingReader{r: resp.Body, onData: onData}, out)
+		return n, false, err
+	}
+	mr := multipart.NewReader(resp.Body, params["boundary"])
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return downloaded, false, nil
+		}
+		if err != nil {
+			return downloaded, false, err
+		}
+		n, err := copyContentRange(part.Header.Get("Content-Range"), &countingReader{r: part, onData: onData}, out)
+		downloaded += n
+		if err != nil {
+			return downloaded, false, err
+		}
+	}
+}
+
+// copyContentRange writes body to out at the start of a "bytes start-end/total" Content-Range
+func copyContentRange(contentRange string, body io.Reader, out io.WriterAt) (int64, error) {
+	var start, end int64
+	_, err := fmt.Sscanf(contentRange, "bytes %d-%d/", &start, &end)
+	if err != nil {
+		return 0, errors.New("zsync: invalid Content-Range " + contentRange)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(body, end-start+1))
+	if err != nil {
+		return int64(len(data)), err
+	}
+	if int64(len(data)) != end-start+1 {
+		return int64(len(data)), errors.New("zsync: short range " + contentRange)
+	}
+	_, err = out.WriteAt(data, start)
+	return int64(len(data)), err
+}
+
+// offsetWriter writes sequentially to an io.WriterAt
+type offsetWriter struct {
+	w   io.WriterAt
+	off int64
+}
+
+func (o *offsetWriter) Write(p []byte) (int, error) {
+	n, err := o.w.WriteAt(p, o.off)
+	o.off += int64(n)
+	return n, err
+}
+
+// countingReader tells onData how much has been read from r
+type countingReader struct {
+	r      io.Reader
+	onData func(int64)
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if n > 0 {
+		c.onData(int64(n))
+	}
+	return n, err
+}
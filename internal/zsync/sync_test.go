@@ -0,0 +1,199 @@
+package zsync
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// serveTarget serves target as App.AppImage with support for (multiple) ranges
+func serveTarget(t *testing.T, target []byte) *url.URL {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeContent(w, r, "App.AppImage", time.Time{}, bytes.NewReader(target))
+	}))
+	t.Cleanup(srv.Close)
+	base, _ := url.Parse(srv.URL + "/App.AppImage.zsync")
+	return base
+}
+
+func syncTo(t *testing.T, control []byte, base *url.URL, seed []byte) ([]byte, Stats, error) {
+	c, err := Parse(bytes.NewReader(control))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(t.TempDir(), "App.AppImage.part"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stats, err := c.Sync(nil, base, bytes.NewReader(seed), int64(len(seed)), out, nil)
+	data, readErr := ioutil.ReadFile(out.Name())
+	if readErr != nil {
+		t.Fatal(readErr)
+	}
+	return data, stats, err
+}
+
+func TestSync(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	target := make([]byte, 64*1024+100)
+	rnd.Read(target)
+	base := serveTarget(t, target)
+	control := makeControlFile(target, 1024, "App.AppImage")
+
+	// The old version has two changed regions and is shifted by a few bytes
+	seed := append([]byte("shift"), target...)
+	rnd.Read(seed[5000:5100])
+	rnd.Read(seed[40000:43000])
+
+	data, stats, err := syncTo(t, control, base, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, target) {
+		t.Fatal("the result differs from the target")
+	}
+	if stats.Reused+stats.Downloaded != int64(len(target)) {
+		t.Errorf("reused %d and downloaded %d bytes of %d", stats.Reused, stats.Downloaded, len(target))
+	}
+	if stats.Downloaded == 0 || stats.Downloaded > 6*1024 {
+		t.Errorf("downloaded %d bytes, expected only the changed blocks", stats.Downloaded)
+	}
+}
+
+func TestSyncWithoutSeed(t *testing.T) {
+	target := []byte(strings.Repeat("AppImage", 1000))
+	base := serveTarget(t, target)
+	data, stats, err := syncTo(t, makeControlFile(target, 2048, "App.AppImage"), base, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, target) || stats.Reused != 0 || stats.Downloaded != int64(len(target)) {
+		t.Errorf("unexpected result, stats %+v", stats)
+	}
+}
+
+func TestSyncDetectsSHA1Mismatch(t *testing.T) {
+	target := []byte(strings.Repeat("AppImage", 1000))
+	changed := append([]byte{}, target...)
+	changed[4000] = 'x'
+	// The server has a different file than the control file describes
+	base := serveTarget(t, changed)
+	_, _, err := syncTo(t, makeControlFile(target, 2048, "App.AppImage"), base, target[:2048])
+	if !errors.Is(err, ErrSHA1Mismatch) {
+		t.Errorf("expected a SHA-1 mismatch, got %v", err)
+	}
+}
+
+// readAtRecorder remembers the largest read from r
+type readAtRecorder struct {
+	r       io.ReaderAt
+	largest int
+}
+
+func (r *readAtRecorder) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > r.largest {
+		r.largest = len(p)
+	}
+	return r.r.ReadAt(p, off)
+}
+
+func TestSyncReadsTheSeedInPieces(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	target := make([]byte, 2<<20+300)
+	rnd.Read(target)
+	base := serveTarget(t, target)
+	c, err := Parse(bytes.NewReader(makeControlFile(target, 1024, "App.AppImage")))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The seed comes in two parts, and one block is only found across the boundary
+	old := append([]byte{}, target[:1<<20+512]...)
+	rnd.Read(old[100000:101000])
+	partial := target[1<<20+512:]
+	seed := &readAtRecorder{r: Concat(
+		io.NewSectionReader(bytes.NewReader(old), 0, int64(len(old))),
+		io.NewSectionReader(bytes.NewReader(partial), 0, int64(len(partial))),
+	)}
+	out, err := os.Create(filepath.Join(t.TempDir(), "App.AppImage.part"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	stats, err := c.Sync(nil, base, seed, int64(len(target)), out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := ioutil.ReadFile(out.Name()); !bytes.Equal(data, target) {
+		t.Error("the result differs from the target")
+	}
+	if stats.Downloaded == 0 || stats.Downloaded > 3*1024 {
+		t.Errorf("downloaded %d bytes, expected only the changed blocks", stats.Downloaded)
+	}
+	if seed.largest > seedReadSize {
+		t.Errorf("read %d bytes of the seed at once", seed.largest)
+	}
+}
+
+type failingReaderAt struct{}
+
+func (failingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	return 0, errors.New("read error")
+}
+
+func TestSyncReportsSeedErrors(t *testing.T) {
+	target := []byte(strings.Repeat("AppImage", 1000))
+	c, err := Parse(bytes.NewReader(makeControlFile(target, 2048, "App.AppImage")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := os.Create(filepath.Join(t.TempDir(), "App.AppImage.part"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer out.Close()
+	if _, err = c.Sync(nil, serveTarget(t, target), failingReaderAt{}, 10000, out, nil); err == nil || err.Error() != "read error" {
+		t.Errorf("expected the read error, got %v", err)
+	}
+}
+
+func TestConcat(t *testing.T) {
+	parts := []string{"App", "", "Image", "s"}
+	var sections []*io.SectionReader
+	for _, p := range parts {
+		sections = append(sections, io.NewSectionReader(strings.NewReader(p), 0, int64(len(p))))
+	}
+	c := Concat(sections...)
+	if c.Size() != 9 {
+		t.Errorf("size %d, want 9", c.Size())
+	}
+	for _, tt := range []struct {
+		off  int64
+		n    int
+		want string
+		err  error
+	}{
+		{0, 9, "AppImages", nil},
+		{2, 4, "pIma", nil},
+		{3, 5, "Image", nil},
+		{7, 4, "es", io.EOF},
+		{9, 1, "", io.EOF},
+	} {
+		p := make([]byte, tt.n)
+		n, err := c.ReadAt(p, tt.off)
+		if string(p[:n]) != tt.want || err != tt.err {
+			t.Errorf("ReadAt(%d, %d) = %q, %v, want %q, %v", tt.n, tt.off, p[:n], err, tt.want, tt.err)
+		}
+	}
+}
@@ -0,0 +1,141 @@
+package goappimage
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+)
+
+// iso9660Reader reads the ISO9660 payload of type-1 AppImages using bsdtar
+type iso9660Reader struct {
+	listingIndex
+	ai      AppImage
+	verbose bool
+	indexed bool
+}
+
+func newISO9660Reader(ai AppImage, verbose bool) (PayloadReader, error) {
+	return &iso9660Reader{ai: ai, verbose: verbose}, nil
+}
+
+// Lines of bsdtar -tv look like
+// lrwxrwxrwx  1 0      0           9 May 20  2020 .DirIcon -> icon.png
+var bsdtarListingLine = regexp.MustCompile(`^([-dlcbps][-rwxsStT]{9})\s+\d+\s+\S+\s+\S+\s+(\d+)\s+(\w{3}\s+\d{1,2}\s+(?:\d{4}|\d{2}:\d{2}))\s(.*)$`)
+
+func (r *iso9660Reader) index() error {
+	if r.indexed {
+		return nil
+	}
+	out, err := runCommand(exec.Command("bsdtar", "-tvf", r.ai.Path), r.verbose)
+	if err != nil {
+		return err
+	}
+	r.add("", payloadFileInfo{mode: os.ModeDir | 0755}, "")
+	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	for scanner.Scan() {
+		m := bsdtarListingLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue
+		}
+		mode, err := parseMode(m[1])
+		if err != nil {
+			continue
+		}
+		size, _ := strconv.ParseInt(m[2], 10, 64)
+		name, target := splitLinkTarget(mode, m[4])
+		r.add(name, payloadFileInfo{size: size, mode: mode, modTime: parseBsdtarTime(m[3])}, target)
+	}
+	r.indexed = true
+	return scanner.Err()
+}
+
+// parseBsdtarTime parses the ls -l style time bsdtar prints,
+// which has either the year or, for recent files, the time of day
+func parseBsdtarTime(s string) time.Time {
+	s = strings.Join(strings.Fields(s), " ")
+	if t, err := time.ParseInLocation("Jan 2 2006", s, time.Local); err == nil {
+		return t
+	}
+	t, err := time.ParseInLocation("Jan 2 15:04", s, time.Local)
+	if err != nil {
+		return time.Time{}
+	}
+	return t.AddDate(time.Now().Year(), 0, 0)
+}
+
+func (r *iso9660Reader) Stat(name string) (os.FileInfo, error) {
+	if err := r.index(); err != nil {
+		return nil, err
+	}
+	return r.listingIndex.Stat(name)
+}
+
+func (r *iso9660Reader) ReadDir(name string) ([]os.FileInfo, error) {
+	if err := r.index(); err != nil {
+		return nil, err
+	}
+	return r.listingIndex.ReadDir(name)
+}
+
+func (r *iso9660Reader) Readlink(name string) (string, error) {
+	if err := r.index(); err != nil {
+		return "", err
+	}
+	return r.listingIndex.Readlink(name)
+}
+
+func (r *iso9660Reader) Open(name string) (io.ReadCloser, error) {
+	out, err := runCommand(exec.Command("bsdtar", "-xOf", r.ai.Path, cleanPayloadName(name)), r.verbose)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(out), nil
+}
+
+func (r *iso9660Reader) Extract(pattern string, destinationdirpath string) error {
+	err := os.MkdirAll(destinationdirpath, os.ModePerm)
+	if err != nil {
+		return err
+	}
+	_, err = runCommand(exec.Command("bsdtar", "-C", destinationdirpath, "-xf", r.ai.Path, pattern), r.verbose)
+	return err
+}
+
+func (r *iso9660Reader) List() (string, error) {
+	out, err := runCommand(exec.Command("bsdtar", "-t", r.ai.Path), r.verbose)
+	return out.String(), err
+}
+
+func (r *iso9660Reader) Metadata() (PayloadMetadata, error) {
+	f, err := os.Open(r.ai.Path)
+	if err != nil {
+		return PayloadMetadata{}, err
+	}
+	defer f.Close()
+	vd, err := helpers.ReadISO9660VolumeDescriptor(f, r.ai.Offset)
+	if err != nil {
+		return PayloadMetadata{}, err
+	}
+	fstime := vd.ModTime
+	if fstime.IsZero() {
+		fstime = vd.CreationTime
+	}
+	return PayloadMetadata{
+		Format: PayloadISO9660,
+		FSTime: fstime,
+		Size:   vd.VolumeSize,
+	}, nil
+}
+
+func (r *iso9660Reader) Close() error {
+	return nil
+}
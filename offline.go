@@ -0,0 +1,231 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/GoAppImage/internal/zsync"
+	"golang.org/x/crypto/openpgp"
+)
+
+// ErrNoUpdate is returned if no newer version of an AppImage was found
+var ErrNoUpdate = errors.New("no newer version found")
+
+// offlineCandidate is an AppImage that may be a newer version of the one being updated
+type offlineCandidate struct {
+	ai          AppImage
+	version     string
+	fsTime      time.Time
+	identity    string // "" if the AppImage has no update information
+	appStreamID string // "" if the AppImage has no AppStream metadata
+}
+
+// newOfflineCandidate reads everything needed about ai, opening its payload only once
+func newOfflineCandidate(ai AppImage) offlineCandidate {
+	c := offlineCandidate{ai: ai}
+	if !ai.UpdateInformation.IsZero() {
+		c.identity, _ = ai.Identity()
+	}
+	payload, err := ai.OpenPayload(false)
+	if err != nil {
+		return c
+	}
+	defer payload.Close()
+	c.version, _ = readVersion(payload)
+	if as, err := readAppStream(payload); err == nil {
+		c.appStreamID = as.ID
+	}
+	if metadata, err := payload.Metadata(); err == nil {
+		c.fsTime = metadata.FSTime
+	}
+	return c
+}
+
+// sameApplication tells whether c and other share their update information or AppStream id
+func (c offlineCandidate) sameApplication(other offlineCandidate) bool {
+	return (c.identity != "" && c.identity == other.identity) || (c.appStreamID != "" && c.appStreamID == other.appStreamID)
+}
+
+// newerThan compares by X-AppImage-Version, or by the time the payload was built if either has no version.
+// If that time is unknown for either, c is not newer.
+func (c offlineCandidate) newerThan(other offlineCandidate) bool {
+	if c.version != "" && other.version != "" {
+		return CompareVersions(c.version, other.version) > 0
+	}
+	if c.fsTime.IsZero() || other.fsTime.IsZero() {
+		return false
+	}
+	return c.fsTime.After(other.fsTime)
+}
+
+// FindOfflineUpdate looks for a newer version of the AppImage in dir, e.g., on a USB stick or an NFS share,
+// without using the network. Candidates are the AppImages in dir that belong to the same application,
+// as told by their update information or AppStream id. If dir holds a .zsync file for a candidate,
+// the candidate has to match the SHA-1 in it. Candidates have to be validly signed, by one of trusted if it is set.
+// The path of the newest candidate is returned, compared by X-AppImage-Version, or by the time the payload
+// was built, if known, if either has no version. Returns ErrNoUpdate if there is no newer version.
+func FindOfflineUpdate(ai AppImage, dir string, trusted openpgp.EntityList) (string, error) {
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return "", err
+	}
+	current := newOfflineCandidate(ai)
+	if current.identity == "" && current.appStreamID == "" {
+		return "", errors.New(ai.Path + " has neither update information nor an AppStream id")
+	}
+	currentInfo, _ := os.Stat(ai.Path)
+
+	controls := make(map[string]*zsync.ControlFile)
+	var candidates []offlineCandidate
+	for _, info := range infos {
+		p := filepath.Join(dir, info.Name())
+		if !info.Mode().IsRegular() || (currentInfo != nil && os.SameFile(info, currentInfo)) {
+			continue
+		}
+		if strings.HasSuffix(info.Name(), ".zsync") {
+			target, control, err := readLocalControlFile(p)
+			if err == nil {
+				controls[target] = control
+			}
+			continue
+		}
+		candidate := NewAppImage(p)
+		if candidate.ImageType < 1 {
+			continue
+		}
+		c := newOfflineCandidate(candidate)
+		if c.sameApplication(current) && c.newerThan(current) {
+			candidates = append(candidates, c)
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].newerThan(candidates[j])
+	})
+
+	var rejected []string
+	for _, c := range candidates {
+		err = verifyOfflineCandidate(c.ai, controls[filepath.Base(c.ai.Path)], trusted)
+		if err == nil {
+			return c.ai.Path, nil
+		}
+		rejected = append(rejected, err.Error())
+	}
+	if len(rejected) > 0 {
+		return "", fmt.Errorf("%w in %s, rejected: %s", ErrNoUpdate, dir, strings.Join(rejected, "; "))
+	}
+	return "", fmt.Errorf("%w in %s", ErrNoUpdate, dir)
+}
+
+// readLocalControlFile reads the header of a .zsync file and returns the name of the file it describes,
+// which is expected to be in the same directory
+func readLocalControlFile(p string) (string, *zsync.ControlFile, error) {
+	f, err := os.Open(p)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	control, err := zsync.ParseHeader(f)
+	if err != nil {
+		return "", nil, err
+	}
+	target := control.Filename
+	if len(control.URLs) > 0 {
+		if u, err := url.Parse(control.URLs[0]); err == nil && !u.IsAbs() {
+			target = path.Base(u.Path)
+		}
+	}
+	return target, control, nil
+}
+
+// verifyOfflineCandidate checks candidate against its .zsync file if there is one, and its signature
+func verifyOfflineCandidate(candidate AppImage, control *zsync.ControlFile, trusted openpgp.EntityList) error {
+	if control != nil {
+		f, err := os.Open(candidate.Path)
+		if err != nil {
+			return err
+		}
+		info, err := f.Stat()
+		if err == nil && info.Size() != control.Length {
+			err = fmt.Errorf("%s has %d bytes, its .zsync file says %d", candidate.Path, info.Size(), control.Length)
+		}
+		if err == nil {
+			err = control.Verify(f)
+		}
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	res, err := candidate.VerifySignature(trusted)
+	if err != nil {
+		return err
+	}
+	if !res.Valid {
+		return fmt.Errorf("%w: %s: %s", ErrNotSigned, candidate.Path, res.Reason)
+	}
+	if trusted != nil && !res.Trusted {
+		return fmt.Errorf("%w: %s is signed by %s", ErrNotTrusted, candidate.Path, res.Fingerprint)
+	}
+	return nil
+}
+
+// UpdateFromDirectory replaces the AppImage with the newest version FindOfflineUpdate finds in dir.
+// The new version is copied next to the AppImage and installed like Update does,
+// except that a valid signature is always required, since removable media are easily tampered with.
+func UpdateFromDirectory(ai AppImage, dir string, opts UpdateOptions) (AppImage, error) {
+	p := newProgressReporter(opts.Progress)
+	p.enter(PhaseResolve)
+	source, err := FindOfflineUpdate(ai, dir, opts.TrustedKeys)
+	if err != nil {
+		return ai, err
+	}
+	part := ai.Path + PartialSuffix
+	p.enter(PhaseDownload)
+	err = copyWithProgress(source, part, p)
+	if err == nil {
+		opts.RequireSignature = true
+		err = installUpdate(ai, part, opts, p)
+	}
+	if err != nil {
+		os.Remove(part)
+		return ai, err
+	}
+	return NewAppImage(ai.Path), nil
+}
+
+// copyWithProgress copies src to dst, replacing whatever was at dst
+func copyWithProgress(src string, dst string, p *progressReporter) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	info, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	// A leftover of an interrupted download must not be resumed into the copy
+	os.Remove(dst + resumeSuffix)
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return err
+	}
+	var done int64
+	_, err = io.Copy(out, &progressReader{r: in, onData: func(n int64) {
+		done += n
+		p.download(done, info.Size(), done)
+	}})
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,42 @@
+package goappimage
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOfflineCandidateNewerThan(t *testing.T) {
+	older := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	newer := older.Add(time.Hour)
+	tests := []struct {
+		name  string
+		c     offlineCandidate
+		other offlineCandidate
+		want  bool
+	}{
+		{"newer version", offlineCandidate{version: "1.10"}, offlineCandidate{version: "1.9"}, true},
+		{"older version", offlineCandidate{version: "1.9", fsTime: newer}, offlineCandidate{version: "1.10", fsTime: older}, false},
+		{"newer payload", offlineCandidate{fsTime: newer}, offlineCandidate{version: "1.0", fsTime: older}, true},
+		{"older payload", offlineCandidate{fsTime: older}, offlineCandidate{fsTime: newer}, false},
+		{"unknown time", offlineCandidate{fsTime: newer}, offlineCandidate{}, false},
+		{"both unknown", offlineCandidate{}, offlineCandidate{}, false},
+	}
+	for _, tt := range tests {
+		if got := tt.c.newerThan(tt.other); got != tt.want {
+			t.Errorf("%s: newerThan = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestOfflineCandidateSameApplication(t *testing.T) {
+	a := offlineCandidate{identity: "zsync|https://example.com/App.zsync", appStreamID: "org.example.App"}
+	if !a.sameApplication(offlineCandidate{appStreamID: "org.example.App"}) {
+		t.Error("same AppStream id is not the same application")
+	}
+	if !a.sameApplication(offlineCandidate{identity: a.identity}) {
+		t.Error("same update information is not the same application")
+	}
+	if (offlineCandidate{}).sameApplication(offlineCandidate{}) {
+		t.Error("AppImages without any id are the same application")
+	}
+}
@@ -0,0 +1,285 @@
+package goappimage
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+)
+
+// PayloadReader gives access to the filesystem image inside an AppImage.
+// Names are relative to the root of the filesystem image, "." or "" being the root itself.
+type PayloadReader interface {
+	// Open opens the named file for reading
+	Open(name string) (io.ReadCloser, error)
+	// ReadDir returns the entries of the named directory, sorted by name
+	ReadDir(name string) ([]os.FileInfo, error)
+	// Stat returns information about the named file without following symlinks
+	Stat(name string) (os.FileInfo, error)
+	// Readlink returns the target of the named symlink
+	Readlink(name string) (string, error)
+	// Metadata returns information about the filesystem image as a whole
+	Metadata() (PayloadMetadata, error)
+	// Extract extracts the files matching pattern (which may contain * wildcards) to destinationdirpath
+	Extract(pattern string, destinationdirpath string) error
+	// List returns the raw listing of the filesystem image as produced by the tools used to read it
+	List() (string, error)
+	// Close releases everything held by the reader
+	Close() error
+}
+
+// PayloadMetadata describes the filesystem image inside an AppImage
+type PayloadMetadata struct {
+	Format string
+	FSTime time.Time // Zero if the format does not record it
+	Size   int64     // Bytes used by the filesystem image, 0 if unknown
+}
+
+// PayloadOpener returns a PayloadReader for the payload of ai
+type PayloadOpener func(ai AppImage, verbose bool) (PayloadReader, error)
+
+// PayloadProbe returns true if a filesystem image of its format starts at offset in r
+type PayloadProbe func(r io.ReaderAt, offset int64) bool
+
+type payloadFormat struct {
+	name   string
+	magic  []byte
+	probe  PayloadProbe
+	opener PayloadOpener
+}
+
+var (
+	payloadFormatsMu sync.RWMutex
+	payloadFormats   []payloadFormat // In the order they are probed in
+)
+
+// RegisterPayloadFormat makes a payload format available to NewAppImage, OpenPayload and everything built on them.
+// probe recognizes an image of the format after the runtime of a type-2 AppImage, and magic is searched for
+// when the image does not start where the ELF headers end. Formats that never follow a type-2 runtime,
+// like ISO9660 in type-1 AppImages, have a nil probe.
+// Formats are probed in the order they are registered in. Registering a format a second time replaces it in place.
+func RegisterPayloadFormat(format string, magic []byte, probe PayloadProbe, opener PayloadOpener) {
+	payloadFormatsMu.Lock()
+	defer payloadFormatsMu.Unlock()
+	f := payloadFormat{name: format, magic: magic, probe: probe, opener: opener}
+	for i := range payloadFormats {
+		if payloadFormats[i].name == format {
+			payloadFormats[i] = f
+			return
+		}
+	}
+	payloadFormats = append(payloadFormats, f)
+}
+
+// unregisterPayloadFormat removes a payload format, so that tests can clean up after themselves
+func unregisterPayloadFormat(format string) {
+	payloadFormatsMu.Lock()
+	defer payloadFormatsMu.Unlock()
+	for i := range payloadFormats {
+		if payloadFormats[i].name == format {
+			payloadFormats = append(payloadFormats[:i], payloadFormats[i+1:]...)
+			return
+		}
+	}
+}
+
+func init() {
+	RegisterPayloadFormat(PayloadSquashfs, helpers.SquashfsMagic, helpers.IsSquashfsAt, newSquashfsReader)
+	RegisterPayloadFormat(PayloadISO9660, nil, nil, newISO9660Reader)
+	RegisterPayloadFormat(PayloadDwarfs, helpers.DwarfsMagic, helpers.IsDwarfsAt, newDwarfsReader)
+}
+
+// payloadProbes returns the probes of the registered formats for the helpers
+func payloadProbes() []helpers.PayloadProbe {
+	payloadFormatsMu.RLock()
+	defer payloadFormatsMu.RUnlock()
+	probes := make([]helpers.PayloadProbe, 0, len(payloadFormats))
+	for _, f := range payloadFormats {
+		if f.probe != nil {
+			probes = append(probes, helpers.PayloadProbe{Format: f.name, Magic: f.magic, Probe: f.probe})
+		}
+	}
+	return probes
+}
+
+func payloadOpener(format string) (PayloadOpener, bool) {
+	payloadFormatsMu.RLock()
+	defer payloadFormatsMu.RUnlock()
+	for _, f := range payloadFormats {
+		if f.name == format {
+			return f.opener, true
+		}
+	}
+	return nil, false
+}
+
+// OpenPayload returns a PayloadReader for the filesystem image inside the AppImage.
+// The reader must be closed after use.
+func (ai AppImage) OpenPayload(verbose bool) (PayloadReader, error) {
+	if ai.ImageType < 1 {
+		return nil, errors.New(ai.Path + " is not an AppImage")
+	}
+	opener, ok := payloadOpener(ai.PayloadFormat)
+	if !ok {
+		return nil, errors.New("unsupported payload format \"" + ai.PayloadFormat + "\" in " + ai.Path)
+	}
+	return opener(ai, verbose)
+}
+
+// payloadFileInfo is the os.FileInfo of a file in a payload
+type payloadFileInfo struct {
+	name    string
+	size    int64
+	mode    os.FileMode
+	modTime time.Time
+}
+
+func (fi payloadFileInfo) Name() string       { return fi.name }
+func (fi payloadFileInfo) Size() int64        { return fi.size }
+func (fi payloadFileInfo) Mode() os.FileMode  { return fi.mode }
+func (fi payloadFileInfo) ModTime() time.Time { return fi.modTime }
+func (fi payloadFileInfo) IsDir() bool        { return fi.mode.IsDir() }
+func (fi payloadFileInfo) Sys() interface{}   { return nil }
+
+type payloadEntry struct {
+	info   payloadFileInfo
+	target string
+}
+
+// listingIndex implements Stat, ReadDir and Readlink on top of a listing of the payload,
+// for formats whose tools can only give us an ls -l style listing
+type listingIndex struct {
+	entries map[string]payloadEntry
+}
+
+func cleanPayloadName(name string) string {
+	name = path.Clean("/" + name)
+	return strings.TrimPrefix(name, "/")
+}
+
+func (li *listingIndex) add(name string, info payloadFileInfo, target string) {
+	if li.entries == nil {
+		li.entries = make(map[string]payloadEntry)
+	}
+	name = cleanPayloadName(name)
+	info.name = path.Base("/" + name)
+	li.entries[name] = payloadEntry{info: info, target: target}
+}
+
+func (li *listingIndex) Stat(name string) (os.FileInfo, error) {
+	entry, ok := li.entries[cleanPayloadName(name)]
+	if !ok {
+		return nil, &os.PathError{Op: "stat", Path: name, Err: os.ErrNotExist}
+	}
+	return entry.info, nil
+}
+
+func (li *listingIndex) Readlink(name string) (string, error) {
+	entry, ok := li.entries[cleanPayloadName(name)]
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: os.ErrNotExist}
+	}
+	if entry.info.mode&os.ModeSymlink == 0 {
+		return "", &os.PathError{Op: "readlink", Path: name, Err: errors.New("not a symlink")}
+	}
+	return entry.target, nil
+}
+
+func (li *listingIndex) ReadDir(name string) ([]os.FileInfo, error) {
+	name = cleanPayloadName(name)
+	if name != "" {
+		entry, ok := li.entries[name]
+		if !ok {
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: os.ErrNotExist}
+		}
+		if !entry.info.IsDir() {
+			return nil, &os.PathError{Op: "readdir", Path: name, Err: errors.New("not a directory")}
+		}
+	}
+	var infos []os.FileInfo
+	for n, entry := range li.entries {
+		if n == "" {
+			continue
+		}
+		dir := path.Dir(n)
+		if dir == "." {
+			dir = ""
+		}
+		if dir == name {
+			infos = append(infos, entry.info)
+		}
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Name() < infos[j].Name() })
+	return infos, nil
+}
+
+// parseMode parses the file mode in an ls -l style listing, e.g., "drwxr-xr-x"
+func parseMode(s string) (os.FileMode, error) {
+	if len(s) < 10 {
+		return 0, errors.New("invalid mode " + s)
+	}
+	var mode os.FileMode
+	switch s[0] {
+	case 'd':
+		mode |= os.ModeDir
+	case 'l':
+		mode |= os.ModeSymlink
+	case 'c':
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 'b':
+		mode |= os.ModeDevice
+	case 'p':
+		mode |= os.ModeNamedPipe
+	case 's':
+		mode |= os.ModeSocket
+	}
+	perm, err := strconv.ParseUint(strings.Map(func(r rune) rune {
+		if r == '-' || r == 'S' || r == 'T' {
+			return '0'
+		}
+		return '1'
+	}, s[1:10]), 2, 32)
+	if err != nil {
+		return 0, err
+	}
+	mode |= os.FileMode(perm)
+	if s[3] == 's' || s[3] == 'S' {
+		mode |= os.ModeSetuid
+	}
+	if s[6] == 's' || s[6] == 'S' {
+		mode |= os.ModeSetgid
+	}
+	if s[9] == 't' || s[9] == 'T' {
+		mode |= os.ModeSticky
+	}
+	return mode, nil
+}
+
+// splitLinkTarget splits "name -> target" as found in ls -l style listings
+func splitLinkTarget(mode os.FileMode, s string) (string, string) {
+	if mode&os.ModeSymlink != 0 {
+		if i := strings.Index(s, " -> "); i >= 0 {
+			return s[:i], s[i+4:]
+		}
+	}
+	return s, ""
+}
+
+// tempFileReadCloser removes the temporary directory holding the file once it is closed
+type tempFileReadCloser struct {
+	*os.File
+	dir string
+}
+
+func (t tempFileReadCloser) Close() error {
+	err := t.File.Close()
+	os.RemoveAll(t.dir)
+	return err
+}
@@ -0,0 +1,55 @@
+package goappimage
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+)
+
+const testPayloadFormat = "testfs"
+
+var testPayloadMagic = []byte("TSTFS\x01")
+
+func init() {
+	RegisterPayloadFormat(testPayloadFormat, testPayloadMagic, func(r io.ReaderAt, offset int64) bool {
+		magic := make([]byte, len(testPayloadMagic))
+		_, err := r.ReadAt(magic, offset)
+		return err == nil && bytes.Equal(magic, testPayloadMagic)
+	}, func(ai AppImage, verbose bool) (PayloadReader, error) {
+		return nil, errors.New("not implemented")
+	})
+}
+
+func TestRegisteredPayloadFormatIsDetected(t *testing.T) {
+	// A runtime followed by the payload, and one with padding between them that has to be scanned for
+	for _, padding := range []int{0, 64} {
+		// The payload does not move the runtime, so its end is known beforehand
+		_, offset := writeTestELF(t, nil, nil)
+		pad := padding
+		if pad > 0 {
+			pad += (4 - int(offset+int64(pad))%4) % 4
+		}
+		path, _ := writeTestELF(t, nil, append(make([]byte, pad), append(testPayloadMagic, make([]byte, 64)...)...))
+		ai := AppImage{Path: path, ImageType: 2}
+		found, err := ai.FindPayloadOffset()
+		if err != nil {
+			t.Fatalf("padding %d: %v", pad, err)
+		}
+		if found != offset+int64(pad) {
+			t.Errorf("padding %d: found the payload at %d, want %d", pad, found, offset+int64(pad))
+		}
+		ai.Offset = found
+		if format := ai.determinePayloadFormat(); format != testPayloadFormat {
+			t.Errorf("padding %d: format %q, want %q", pad, format, testPayloadFormat)
+		}
+	}
+}
+
+func TestUnknownPayloadIsNotDetected(t *testing.T) {
+	path, _ := writeTestELF(t, nil, make([]byte, 4096))
+	_, err := AppImage{Path: path, ImageType: 2}.FindPayloadOffset()
+	if err == nil {
+		t.Fatal("expected an error for a runtime without a known payload")
+	}
+}
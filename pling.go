@@ -0,0 +1,128 @@
+package goappimage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// PlingFile is a file of a product on Pling (a.k.a. OpenDesktop, AppImageHub)
+type PlingFile struct {
+	Name string
+	URL  string
+	Size int64
+	MD5  string
+}
+
+// PlingClient talks to the OCS API of Pling.
+// BaseURL can be pointed at another OCS server or a local test server.
+type PlingClient struct {
+	BaseURL    string
+	HTTPClient *http.Client
+}
+
+// DefaultPlingClient is used to resolve pling-v1-zsync update information
+var DefaultPlingClient = &PlingClient{BaseURL: "https://api.pling.com/ocs/v1"}
+
+func (c *PlingClient) httpClient() *http.Client {
+	if c.HTTPClient != nil {
+		return c.HTTPClient
+	}
+	return http.DefaultClient
+}
+
+// Files returns the files of the product with productID, in the order Pling numbers them,
+// which is the order they were uploaded in
+func (c *PlingClient) Files(productID string) ([]PlingFile, error) {
+	u := strings.TrimSuffix(c.BaseURL, "/") + "/content/data/" + url.PathEscape(productID) + "?format=json"
+	resp, err := c.httpClient().Get(u)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Pling API: %s: %s", u, resp.Status)
+	}
+	// The files are flattened into the product as downloadlink1, downloadname1, downloadlink2, ...
+	var content struct {
+		Status  string
+		Message string
+		Data    []map[string]interface{}
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	err = dec.Decode(&content)
+	if err != nil {
+		return nil, err
+	}
+	if content.Status != "ok" {
+		return nil, errors.New("Pling API: " + u + ": " + content.Status + " " + content.Message)
+	}
+	if len(content.Data) == 0 {
+		return nil, errors.New("Pling API: no product " + productID)
+	}
+	product := content.Data[0]
+	var files []PlingFile
+	for i := 1; ; i++ {
+		n := strconv.Itoa(i)
+		if _, ok := product["downloadlink"+n]; !ok {
+			break
+		}
+		f := PlingFile{
+			URL:  plingString(product, "downloadlink"+n),
+			Name: plingString(product, "downloadname"+n),
+			MD5:  plingString(product, "downloadmd5sum"+n),
+		}
+		f.Size, _ = strconv.ParseInt(plingString(product, "downloadsize"+n), 10, 64)
+		if f.URL == "" {
+			continue
+		}
+		if f.Name == "" {
+			f.Name = path.Base(f.URL)
+		}
+		files = append(files, f)
+	}
+	return files, nil
+}
+
+// plingString returns a value of a product as a string, the API is not consistent about numbers and strings
+func plingString(product map[string]interface{}, key string) string {
+	v := product[key]
+	if v == nil {
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// FindPlingFile returns the file whose name matches pattern, see MatchUpdateFilename.
+// If several do, the one uploaded last is returned.
+func FindPlingFile(files []PlingFile, pattern string) (*PlingFile, error) {
+	for i := len(files) - 1; i >= 0; i-- {
+		ok, err := MatchUpdateFilename(pattern, files[i].Name)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			return &files[i], nil
+		}
+	}
+	return nil, errors.New("no file matching " + pattern + " on Pling")
+}
+
+// resolvePling returns the URL of the .zsync file pling-v1-zsync update information points to
+func (ui UpdateInformation) resolvePling(c *PlingClient) (UpdateTarget, error) {
+	files, err := c.Files(ui.ProductID())
+	if err != nil {
+		return UpdateTarget{}, err
+	}
+	f, err := FindPlingFile(files, ui.Filename())
+	if err != nil {
+		return UpdateTarget{}, err
+	}
+	return UpdateTarget{URL: f.URL, Zsync: true, Client: c.HTTPClient}, nil
+}
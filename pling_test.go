@@ -0,0 +1,105 @@
+package goappimage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// The OCS API answers like this for a product, with numbers sometimes as strings
+const plingTestProduct = `{"status": "ok", "message": "", "data": [{
+	"id": 1234,
+	"downloadlink1": "https://files.example.com/App-1.0-x86_64.AppImage.zsync",
+	"downloadname1": "App-1.0-x86_64.AppImage.zsync",
+	"downloadsize1": "2048",
+	"downloadmd5sum1": "0123456789abcdef0123456789abcdef",
+	"downloadlink2": "https://files.example.com/App-2.0-x86_64.AppImage.zsync",
+	"downloadname2": "",
+	"downloadsize2": 4096,
+	"downloadlink3": "",
+	"downloadname3": "Removed.AppImage.zsync",
+	"downloadlink4": "https://files.example.com/App-2.0-aarch64.AppImage.zsync",
+	"downloadname4": "App-2.0-aarch64.AppImage.zsync"
+}]}`
+
+// usePlingServer points DefaultPlingClient at a server that serves product 1234 until the test ends
+func usePlingServer(t *testing.T) *PlingClient {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/ocs/v1/content/data/1234" && r.URL.Query().Get("format") == "json":
+			w.Write([]byte(plingTestProduct))
+		case r.URL.Path == "/ocs/v1/content/data/404":
+			w.Write([]byte(`{"status": "failed", "message": "content not found", "data": []}`))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	old := DefaultPlingClient
+	DefaultPlingClient = &PlingClient{BaseURL: srv.URL + "/ocs/v1/", HTTPClient: srv.Client()}
+	t.Cleanup(func() { DefaultPlingClient = old })
+	return DefaultPlingClient
+}
+
+func TestPlingFiles(t *testing.T) {
+	c := usePlingServer(t)
+	files, err := c.Files("1234")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []PlingFile{
+		{Name: "App-1.0-x86_64.AppImage.zsync", URL: "https://files.example.com/App-1.0-x86_64.AppImage.zsync", Size: 2048, MD5: "0123456789abcdef0123456789abcdef"},
+		// Without a name, the name is taken from the link
+		{Name: "App-2.0-x86_64.AppImage.zsync", URL: "https://files.example.com/App-2.0-x86_64.AppImage.zsync", Size: 4096},
+		{Name: "App-2.0-aarch64.AppImage.zsync", URL: "https://files.example.com/App-2.0-aarch64.AppImage.zsync"},
+	}
+	if len(files) != len(want) {
+		t.Fatalf("got %+v", files)
+	}
+	for i := range want {
+		if files[i] != want[i] {
+			t.Errorf("file %d is %+v, want %+v", i, files[i], want[i])
+		}
+	}
+
+	if _, err = c.Files("404"); err == nil {
+		t.Error("expected an error for a failed status")
+	}
+	if _, err = c.Files("5678"); err == nil {
+		t.Error("expected an error for a 404")
+	}
+}
+
+func TestPlingResolvesTheLastMatchingFile(t *testing.T) {
+	usePlingServer(t)
+	tests := []struct {
+		filename string
+		url      string
+	}{
+		{"App-*-x86_64.AppImage.zsync", "https://files.example.com/App-2.0-x86_64.AppImage.zsync"},
+		{"App-1.?-x86_64.AppImage.zsync", "https://files.example.com/App-1.0-x86_64.AppImage.zsync"},
+		{"App-*.AppImage.zsync", "https://files.example.com/App-2.0-aarch64.AppImage.zsync"},
+		{"Removed.AppImage.zsync", ""},
+	}
+	for _, tt := range tests {
+		ui, err := ParseUpdateInformation("pling-v1-zsync|1234|" + tt.filename)
+		if err != nil {
+			t.Fatal(err)
+		}
+		target, err := ui.ResolveURL()
+		if tt.url == "" {
+			if err == nil {
+				t.Errorf("%s: expected an error, resolved to %s", tt.filename, target.URL)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.filename, err)
+			continue
+		}
+		if target.URL != tt.url || !target.Zsync || target.Client != DefaultPlingClient.HTTPClient {
+			t.Errorf("%s: resolved to %+v", tt.filename, target)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+package goappimage
+
+import "time"
+
+// UpdatePhase is the step an update is in
+type UpdatePhase int
+
+// The phases of an update, in order
+const (
+	PhaseResolve UpdatePhase = iota
+	PhaseDownload
+	PhaseVerify
+	PhaseInstall
+)
+
+func (p UpdatePhase) String() string {
+	switch p {
+	case PhaseResolve:
+		return "resolve"
+	case PhaseDownload:
+		return "download"
+	case PhaseVerify:
+		return "verify"
+	case PhaseInstall:
+		return "install"
+	}
+	return "unknown"
+}
+
+// Progress is reported by downloads and updates.
+// Done and Total are only set during PhaseDownload.
+type Progress struct {
+	Phase UpdatePhase
+	Done  int64   // Bytes of the file that are available locally, including resumed or reused ones
+	Total int64   // Size of the file, 0 if unknown
+	Rate  float64 // Bytes per second actually transferred in this phase
+}
+
+// ProgressFunc receives Progress. It is called from the goroutine doing the work and should return quickly.
+type ProgressFunc func(Progress)
+
+// Download progress is reported at most this often, except for the final one
+const progressInterval = 100 * time.Millisecond
+
+// progressReporter computes the rate and throttles calls to a ProgressFunc, which may be nil
+type progressReporter struct {
+	fn         ProgressFunc
+	phase      UpdatePhase
+	start      time.Time
+	lastReport time.Time
+}
+
+func newProgressReporter(fn ProgressFunc) *progressReporter {
+	return &progressReporter{fn: fn}
+}
+
+// enter starts phase and reports it
+func (p *progressReporter) enter(phase UpdatePhase) {
+	p.phase = phase
+	p.start = time.Now()
+	p.lastReport = time.Time{}
+	if p.fn != nil {
+		p.fn(Progress{Phase: phase})
+	}
+}
+
+// download reports that done of total bytes are available, transferred of them during this phase
+func (p *progressReporter) download(done int64, total int64, transferred int64) {
+	if p.fn == nil {
+		return
+	}
+	now := time.Now()
+	if now.Sub(p.lastReport) < progressInterval && done != total {
+		return
+	}
+	p.lastReport = now
+	var rate float64
+	if elapsed := now.Sub(p.start).Seconds(); elapsed > 0 {
+		rate = float64(transferred) / elapsed
+	}
+	p.fn(Progress{Phase: p.phase, Done: done, Total: total, Rate: rate})
+}
@@ -0,0 +1,176 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+	"github.com/CalebQ42/GoAppImage/internal/squashfs"
+)
+
+// Remote files are read in chunks of this size, squashfs metadata is read in many small pieces
+// that are close to each other
+const remoteChunkSize = 64 * 1024
+
+// errRemotePayload is returned for what cannot be done with the payload of a remote AppImage
+var errRemotePayload = errors.New("not supported for the payload of a remote AppImage")
+
+// httpRangeReader reads a file on an HTTP server with range requests. It is not safe for concurrent use.
+type httpRangeReader struct {
+	client *http.Client
+	url    string
+	size   int64
+	chunks map[int64][]byte
+}
+
+// newHTTPRangeReader returns a reader for fileURL. The first chunk is read right away,
+// which tells the size of the file and whether the server supports range requests at all.
+func newHTTPRangeReader(client *http.Client, fileURL string) (*httpRangeReader, error) {
+	r := &httpRangeReader{client: client, url: fileURL, chunks: make(map[int64][]byte)}
+	_, err := r.chunk(0)
+	if err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *httpRangeReader) chunk(i int64) ([]byte, error) {
+	if c, ok := r.chunks[i]; ok {
+		return c, nil
+	}
+	start := i * remoteChunkSize
+	req, err := http.NewRequest(http.MethodGet, r.url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", start, start+remoteChunkSize-1))
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		// The server sends the whole file, which is what we are trying to avoid
+		return nil, errors.New(r.url + ": server does not support range requests")
+	}
+	if resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("%s: %s", r.url, resp.Status)
+	}
+	var first, last, total int64
+	_, err = fmt.Sscanf(resp.Header.Get("Content-Range"), "bytes %d-%d/%d", &first, &last, &total)
+	if err != nil || first != start || last < first || last-first >= remoteChunkSize || (r.size != 0 && total != r.size) {
+		return nil, fmt.Errorf("%s: unexpected Content-Range %q", r.url, resp.Header.Get("Content-Range"))
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(resp.Body, remoteChunkSize))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != last-first+1 {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r.size = total
+	r.chunks[i] = data
+	return data, nil
+}
+
+func (r *httpRangeReader) ReadAt(p []byte, off int64) (int, error) {
+	n := 0
+	for n < len(p) {
+		pos := off + int64(n)
+		if pos < 0 || pos >= r.size {
+			return n, io.EOF
+		}
+		c, err := r.chunk(pos / remoteChunkSize)
+		if err != nil {
+			return n, err
+		}
+		if pos%remoteChunkSize >= int64(len(c)) {
+			return n, io.ErrUnexpectedEOF
+		}
+		n += copy(p[n:], c[pos%remoteChunkSize:])
+	}
+	return n, nil
+}
+
+// remotePayloadReader reads the squashfs payload of a remote AppImage.
+// Only what is read is downloaded, so nothing that needs the payload as a whole is supported.
+type remotePayloadReader struct {
+	*squashfs.Reader
+}
+
+// openRemotePayload opens the payload of the AppImage at fileURL without downloading it
+func openRemotePayload(client *http.Client, fileURL string) (PayloadReader, error) {
+	r, err := newHTTPRangeReader(client, fileURL)
+	if err != nil {
+		return nil, err
+	}
+	// Scanning for the payload would mean downloading the runtime, so only the ELF headers are asked
+	for _, offset := range helpers.PayloadOffsetCandidates(r) {
+		if helpers.IsSquashfsAt(r, offset) {
+			fs, err := squashfs.Open(r, offset)
+			if err != nil {
+				return nil, err
+			}
+			return remotePayloadReader{fs}, nil
+		}
+	}
+	return nil, errors.New(fileURL + ": no squashfs payload found where the runtime ends")
+}
+
+func (r remotePayloadReader) Metadata() (PayloadMetadata, error) {
+	return PayloadMetadata{Format: PayloadSquashfs, FSTime: r.ModTime(), Size: r.Size()}, nil
+}
+
+func (r remotePayloadReader) Extract(pattern string, destinationdirpath string) error {
+	return errRemotePayload
+}
+
+func (r remotePayloadReader) List() (string, error) {
+	return "", errRemotePayload
+}
+
+func (r remotePayloadReader) Close() error {
+	return nil
+}
+
+// remoteAppImageURL returns the URL of the AppImage the update information points to,
+// and the client to download it with
+func (ui UpdateInformation) remoteAppImageURL() (string, *http.Client, error) {
+	target, err := ui.ResolveURL()
+	if err != nil {
+		return "", nil, err
+	}
+	client := target.httpClient()
+	if !target.Zsync {
+		return target.URL, client, nil
+	}
+	control, err := fetchZsyncHeader(client, target.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	base, err := url.Parse(target.URL)
+	if err != nil {
+		return "", nil, err
+	}
+	fileURL, err := control.FileURL(base)
+	return fileURL, client, err
+}
+
+// readRemoteAppStream reads the AppStream metadata of the AppImage the update information points to,
+// downloading only the parts of it that are needed with range requests
+func (ui UpdateInformation) readRemoteAppStream() (*AppStream, error) {
+	fileURL, client, err := ui.remoteAppImageURL()
+	if err != nil {
+		return nil, err
+	}
+	payload, err := openRemotePayload(client, fileURL)
+	if err != nil {
+		return nil, err
+	}
+	defer payload.Close()
+	return readAppStream(payload)
+}
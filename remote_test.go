@@ -0,0 +1,127 @@
+package goappimage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/CalebQ42/GoAppImage/internal/squashfs/squashfstest"
+)
+
+const remoteTestAppStream = `<?xml version="1.0" encoding="UTF-8"?>
+<component type="desktop-application">
+  <id>org.example.App</id>
+  <releases>
+    <release version="2.0" date="2021-03-01">
+      <description><p>Faster startup.</p></description>
+    </release>
+    <release version="1.0" date="2020-01-01">
+      <description><p>First release.</p></description>
+    </release>
+  </releases>
+</component>
+`
+
+// remoteTestAppImage returns an AppImage with AppStream metadata and a large file that has nothing to do with it
+func remoteTestAppImage(t *testing.T) []byte {
+	t.Helper()
+	large := make([]byte, 4<<20)
+	rand.New(rand.NewSource(1)).Read(large)
+	payload := squashfstest.Build(&squashfstest.File{Dir: true, Children: []*squashfstest.File{
+		{Name: "AppRun", Data: []byte("#!/bin/sh\n")},
+		{Name: "usr", Dir: true, Children: []*squashfstest.File{
+			{Name: "lib", Dir: true, Children: []*squashfstest.File{{Name: "libapp.so", Data: large}}},
+			{Name: "share", Dir: true, Children: []*squashfstest.File{
+				{Name: "metainfo", Dir: true, Children: []*squashfstest.File{
+					{Name: "org.example.App.appdata.xml", Data: []byte(remoteTestAppStream)},
+				}},
+			}},
+		}},
+	}}, squashfstest.Options{ModTime: 1614556800})
+	path, _ := writeTestELF(t, nil, payload)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// serveRemote serves files by name, with range requests unless ranges is false,
+// and returns the URL of the server and the number of bytes of files sent
+func serveRemote(t *testing.T, files map[string][]byte, ranges bool) (string, *int64) {
+	t.Helper()
+	var sent int64
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		data, ok := files[strings.TrimPrefix(r.URL.Path, "/")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		cw := &countingWriter{ResponseWriter: w, n: &sent}
+		if !ranges {
+			cw.Write(data)
+			return
+		}
+		http.ServeContent(cw, r, r.URL.Path, time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, &sent
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	n *int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	atomic.AddInt64(w.n, int64(n))
+	return n, err
+}
+
+func TestChangelogReadsRemoteAppStream(t *testing.T) {
+	remote := remoteTestAppImage(t)
+	zsyncHeader := "zsync: 0.6.2\nFilename: App.AppImage\nBlocksize: 4096\nLength: 1\n" +
+		"Hash-Lengths: 1,4,16\nURL: App.AppImage\nSHA-1: 0000000000000000000000000000000000000000\n\n"
+	srvURL, sent := serveRemote(t, map[string][]byte{
+		"App.AppImage":       remote,
+		"App.AppImage.zsync": []byte(zsyncHeader),
+	}, true)
+
+	for _, ui := range []UpdateInformation{
+		{Transport: "test-kv", Fields: []string{srvURL, "App.AppImage"}},
+		{Transport: "zsync", Fields: []string{srvURL + "/App.AppImage.zsync"}},
+	} {
+		atomic.StoreInt64(sent, 0)
+		current := writeSignableAppImage(t, 1)
+		current.UpdateInformation = ui
+		entries, err := current.Changelog(nil)
+		if err != nil {
+			t.Fatalf("%s: %v", ui.Transport, err)
+		}
+		if len(entries) != 2 || entries[0].Version != "2.0" || entries[0].Description != "Faster startup." ||
+			entries[0].Source != ChangelogAppStream || entries[0].Date.Format("2006-01-02") != "2021-03-01" {
+			t.Errorf("%s: entries %+v", ui.Transport, entries)
+		}
+		// The large file is not downloaded
+		if n := atomic.LoadInt64(sent); n > int64(len(remote))/8 {
+			t.Errorf("%s: %d bytes of %d were downloaded", ui.Transport, n, len(remote))
+		}
+	}
+}
+
+func TestChangelogWithoutRangeRequests(t *testing.T) {
+	srvURL, _ := serveRemote(t, map[string][]byte{"App.AppImage": remoteTestAppImage(t)}, false)
+	current := writeSignableAppImage(t, 1)
+	current.UpdateInformation = UpdateInformation{Transport: "test-kv", Fields: []string{srvURL, "App.AppImage"}}
+	entries, err := current.Changelog(nil)
+	if len(entries) != 0 || err == nil || !strings.Contains(err.Error(), "range requests") {
+		t.Errorf("expected an error about range requests, got %v, %v", entries, err)
+	}
+}
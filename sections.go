@@ -0,0 +1,97 @@
+package goappimage
+
+import (
+	"debug/elf"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// AppImageSectionNames are the ELF sections defined by the AppImage specification,
+// https://github.com/AppImage/AppImageSpec/blob/master/draft.md#type-2-image-format
+var AppImageSectionNames = []string{
+	".upd_info",   // Update information
+	".sha256_sig", // Detached OpenPGP signature of the SHA-256 digest
+	".sig_key",    // Public key used for the signature
+	".digest_md5", // Legacy MD5 digest
+}
+
+// Section describes an AppImage-defined ELF section.
+// Offset and Size are the location of the section contents within the AppImage file,
+// which is what signing, verification and rewriting tools need
+type Section struct {
+	Name   string
+	Offset int64
+	Size   int64
+	Data   []byte
+}
+
+// ReadSections reads all AppImage-defined ELF sections from the AppImage in one pass.
+// Sections that are not present in the runtime are not part of the result.
+// Any section whose name starts with ".appimage" is treated as AppImage-defined, too.
+func (ai AppImage) ReadSections() (map[string]Section, error) {
+	f, err := os.Open(ai.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	e, err := elf.NewFile(f)
+	if err != nil {
+		return nil, err
+	}
+	sections := make(map[string]Section)
+	for _, s := range e.Sections {
+		if !isAppImageSection(s.Name) || s.Type == elf.SHT_NOBITS {
+			continue
+		}
+		// The section header is not to be trusted before allocating
+		if s.Offset > uint64(info.Size()) || s.Size > uint64(info.Size())-s.Offset {
+			return nil, fmt.Errorf("section %s at offset %d with size %d exceeds the file size %d", s.Name, s.Offset, s.Size, info.Size())
+		}
+		data := make([]byte, s.Size)
+		_, err = f.ReadAt(data, int64(s.Offset))
+		if err != nil {
+			return nil, err
+		}
+		sections[s.Name] = Section{
+			Name:   s.Name,
+			Offset: int64(s.Offset),
+			Size:   int64(s.Size),
+			Data:   data,
+		}
+	}
+	return sections, nil
+}
+
+func isAppImageSection(name string) bool {
+	for _, n := range AppImageSectionNames {
+		if n == name {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, ".appimage")
+}
+
+// writeSection replaces the contents of the named section in place, padding data with zero bytes.
+// The sections have a fixed size reserved by the runtime, data that does not fit is an error.
+func (ai AppImage) writeSection(section Section, data []byte) error {
+	if int64(len(data)) > section.Size {
+		return fmt.Errorf("%d bytes do not fit into the %d bytes reserved for %s", len(data), section.Size, section.Name)
+	}
+	f, err := os.OpenFile(ai.Path, os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	padded := make([]byte, section.Size)
+	copy(padded, data)
+	_, err = f.WriteAt(padded, section.Offset)
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
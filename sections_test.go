@@ -0,0 +1,41 @@
+package goappimage
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestReadSections(t *testing.T) {
+	path, _ := writeTestELF(t, []testSection{
+		{name: ".upd_info", data: []byte("zsync|https://example.com/a.zsync\x00\x00\x00")},
+		{name: ".sha256_sig", data: make([]byte, 32)},
+		{name: ".text", data: []byte{0x90}},
+	}, nil)
+	sections, err := AppImage{Path: path}.ReadSections()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := sections[".text"]; ok {
+		t.Error("non-AppImage section .text was read")
+	}
+	upd, ok := sections[".upd_info"]
+	if !ok {
+		t.Fatal(".upd_info is missing")
+	}
+	if !bytes.HasPrefix(upd.Data, []byte("zsync|https://example.com/a.zsync")) || upd.Size != int64(len(upd.Data)) {
+		t.Errorf("unexpected .upd_info %+v", upd)
+	}
+	if sections[".sha256_sig"].Size != 32 {
+		t.Errorf(".sha256_sig has size %d, want 32", sections[".sha256_sig"].Size)
+	}
+}
+
+func TestReadSectionsRejectsOversizedSection(t *testing.T) {
+	path, _ := writeTestELF(t, []testSection{
+		{name: ".upd_info", data: make([]byte, 16), size: 1 << 60},
+	}, nil)
+	_, err := AppImage{Path: path}.ReadSections()
+	if err == nil {
+		t.Fatal("expected an error for a section larger than the file")
+	}
+}
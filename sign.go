@@ -0,0 +1,70 @@
+package goappimage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// Sign signs the AppImage in place, like appimagetool --sign does.
+// The digest is calculated as described for Digest, signed with the private key of signer,
+// and the armored detached signature and the armored public key of signer are written
+// into the .sha256_sig and .sig_key sections. signer's private key must already be decrypted.
+// Nothing is written if the signature or the key do not fit into the space the runtime reserves for them.
+func (ai AppImage) Sign(signer *openpgp.Entity) error {
+	if signer == nil || signer.PrivateKey == nil {
+		return errors.New("signing needs a private key")
+	}
+	if signer.PrivateKey.Encrypted {
+		return errors.New("private key is encrypted, decrypt it before signing")
+	}
+	sections, err := ai.ReadSections()
+	if err != nil {
+		return err
+	}
+	sigSection, ok := sections[".sha256_sig"]
+	if !ok {
+		return errors.New(ai.Path + " has no .sha256_sig section")
+	}
+	keySection, ok := sections[".sig_key"]
+	if !ok {
+		return errors.New(ai.Path + " has no .sig_key section")
+	}
+
+	digest, err := ai.digest(sha256.New(), sections, ".sha256_sig", ".sig_key")
+	if err != nil {
+		return err
+	}
+	var sig bytes.Buffer
+	err = openpgp.ArmoredDetachSign(&sig, signer, bytes.NewReader([]byte(hex.EncodeToString(digest))), nil)
+	if err != nil {
+		return err
+	}
+	var key bytes.Buffer
+	w, err := armor.Encode(&key, openpgp.PublicKeyType, nil)
+	if err != nil {
+		return err
+	}
+	err = signer.Serialize(w)
+	if err != nil {
+		return err
+	}
+	err = w.Close()
+	if err != nil {
+		return err
+	}
+
+	// Check both sizes before writing anything so that we never leave a half-signed AppImage behind
+	if sig.Len() > int(sigSection.Size) || key.Len() > int(keySection.Size) {
+		return errors.New("signature or key do not fit into the sections reserved by the runtime")
+	}
+	err = ai.writeSection(sigSection, sig.Bytes())
+	if err != nil {
+		return err
+	}
+	return ai.writeSection(keySection, key.Bytes())
+}
@@ -0,0 +1,52 @@
+package goappimage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestSignRejectsWhatDoesNotFit(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	tests := []struct {
+		name    string
+		sigSize int
+		keySize int
+	}{
+		{"signature", 64, 8192},
+		{"key", 1024, 64},
+	}
+	for _, tt := range tests {
+		path, _ := writeTestELF(t, []testSection{
+			{name: ".sha256_sig", data: make([]byte, tt.sigSize)},
+			{name: ".sig_key", data: make([]byte, tt.keySize)},
+		}, testSquashfs(8192))
+		before, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = (AppImage{Path: path}).Sign(signer); err == nil {
+			t.Errorf("%s: expected an error for a section that is too small", tt.name)
+		}
+		if after, err := ioutil.ReadFile(path); err != nil || !bytes.Equal(after, before) {
+			t.Errorf("%s: the AppImage was changed: %v", tt.name, err)
+		}
+	}
+}
+
+func TestSignNeedsAPrivateKey(t *testing.T) {
+	ai := writeSignableAppImage(t, 1)
+	public := newTestEntity(t, "signer")
+	public.PrivateKey = nil
+	if err := ai.Sign(public); err == nil {
+		t.Error("expected an error for a key without its private key")
+	}
+	encrypted := newTestEntity(t, "signer")
+	encrypted.PrivateKey.Encrypted = true
+	if err := ai.Sign(encrypted); err == nil {
+		t.Error("expected an error for an encrypted private key")
+	}
+	if err := ai.Sign(nil); err == nil {
+		t.Error("expected an error for no key")
+	}
+}
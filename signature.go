@@ -0,0 +1,115 @@
+package goappimage
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"time"
+
+	"golang.org/x/crypto/openpgp"
+	"golang.org/x/crypto/openpgp/armor"
+)
+
+// SignatureResult is the result of verifying the signature embedded in an AppImage.
+// Reason is empty if the signature is valid, and says why it is not otherwise.
+type SignatureResult struct {
+	Signed          bool // The AppImage has an embedded signature at all
+	Valid           bool // The signature matches the digest of the AppImage
+	Trusted         bool // The signer's key is in the caller-supplied trusted keyring
+	Fingerprint     string
+	KeyCreationTime time.Time
+	Reason          string
+}
+
+// ReadKeyRing reads an armored or binary OpenPGP keyring
+func ReadKeyRing(r io.Reader) (openpgp.EntityList, error) {
+	br := bufio.NewReader(r)
+	start, _ := br.Peek(len("-----BEGIN"))
+	if string(start) == "-----BEGIN" {
+		return openpgp.ReadArmoredKeyRing(br)
+	}
+	return openpgp.ReadKeyRing(br)
+}
+
+// VerifySignature verifies the .sha256_sig section against the digest of the AppImage.
+// The signature is checked against the public key embedded in the .sig_key section and the keys in trusted,
+// which may be nil. The signature only counts as Trusted if it was made by a key in trusted.
+// Returns error only if the AppImage could not be read, verification failures are described by the result.
+func (ai AppImage) VerifySignature(trusted openpgp.EntityList) (SignatureResult, error) {
+	var res SignatureResult
+	sections, err := ai.ReadSections()
+	if err != nil {
+		return res, err
+	}
+	sig := bytes.Trim(sections[".sha256_sig"].Data, "\x00")
+	if len(sig) == 0 {
+		res.Reason = "AppImage is not signed"
+		return res, nil
+	}
+	res.Signed = true
+	digest, err := ai.digest(sha256.New(), sections, ".sha256_sig", ".sig_key")
+	if err != nil {
+		return res, err
+	}
+
+	keyring := append(openpgp.EntityList{}, trusted...)
+	key := bytes.Trim(sections[".sig_key"].Data, "\x00")
+	if len(key) > 0 {
+		embedded, err := ReadKeyRing(bytes.NewReader(key))
+		if err != nil {
+			res.Reason = "cannot read embedded key: " + err.Error()
+			if len(trusted) == 0 {
+				return res, nil
+			}
+		}
+		keyring = append(keyring, embedded...)
+	}
+	if len(keyring) == 0 {
+		res.Reason = "no key to verify the signature with"
+		return res, nil
+	}
+
+	// The signature is made for the hex encoded digest
+	signed := []byte(hex.EncodeToString(digest))
+	signer, err := checkDetachedSignature(keyring, signed, sig)
+	if signer != nil {
+		res.Fingerprint = fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+		res.KeyCreationTime = signer.PrimaryKey.CreationTime
+		res.Trusted = isKeyInKeyRing(trusted, signer.PrimaryKey.Fingerprint)
+	}
+	if err != nil {
+		res.Reason = err.Error()
+		return res, nil
+	}
+	res.Valid = true
+	res.Reason = ""
+	return res, nil
+}
+
+// checkDetachedSignature checks an armored or binary detached signature
+func checkDetachedSignature(keyring openpgp.EntityList, signed []byte, sig []byte) (*openpgp.Entity, error) {
+	if bytes.HasPrefix(bytes.TrimSpace(sig), []byte("-----BEGIN")) {
+		block, err := armor.Decode(bytes.NewReader(bytes.TrimSpace(sig)))
+		if err != nil {
+			return nil, err
+		}
+		sig, err = ioutil.ReadAll(block.Body)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return openpgp.CheckDetachedSignature(keyring, bytes.NewReader(signed), bytes.NewReader(sig))
+}
+
+func isKeyInKeyRing(keyring openpgp.EntityList, fingerprint [20]byte) bool {
+	for _, e := range keyring {
+		if e.PrimaryKey.Fingerprint == fingerprint {
+			return true
+		}
+	}
+	return false
+}
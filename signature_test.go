@@ -0,0 +1,70 @@
+package goappimage
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+func TestVerifySignature(t *testing.T) {
+	signer := newTestEntity(t, "signer")
+	ai := writeSignableAppImage(t, 1)
+	res, err := ai.VerifySignature(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Signed || res.Valid {
+		t.Errorf("unsigned AppImage: %+v", res)
+	}
+
+	if err = ai.Sign(signer); err != nil {
+		t.Fatal(err)
+	}
+	fingerprint := fmt.Sprintf("%X", signer.PrimaryKey.Fingerprint)
+	// Only the embedded key is known
+	res, err = ai.VerifySignature(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Signed || !res.Valid || res.Trusted || res.Fingerprint != fingerprint || res.Reason != "" {
+		t.Errorf("signed AppImage without trusted keys: %+v", res)
+	}
+	res, err = ai.VerifySignature(openpgp.EntityList{signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid || !res.Trusted {
+		t.Errorf("signed AppImage with the key in the keyring: %+v", res)
+	}
+	res, err = ai.VerifySignature(openpgp.EntityList{newTestEntity(t, "other")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Valid || res.Trusted {
+		t.Errorf("signed AppImage with another key in the keyring: %+v", res)
+	}
+
+	// Flip a byte of the payload
+	f, err := os.OpenFile(ai.Path, os.O_RDWR, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := make([]byte, 1)
+	if _, err = f.ReadAt(b, ai.Offset+4096); err == nil {
+		b[0] ^= 0xff
+		_, err = f.WriteAt(b, ai.Offset+4096)
+	}
+	f.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err = ai.VerifySignature(openpgp.EntityList{signer})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.Signed || res.Valid || res.Reason == "" {
+		t.Errorf("tampered AppImage: %+v", res)
+	}
+}
@@ -0,0 +1,138 @@
+package goappimage
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+)
+
+// squashfsReader reads squashfs payloads using unsquashfs
+type squashfsReader struct {
+	listingIndex
+	ai      AppImage
+	verbose bool
+	indexed bool
+}
+
+func newSquashfsReader(ai AppImage, verbose bool) (PayloadReader, error) {
+	return &squashfsReader{ai: ai, verbose: verbose}, nil
+}
+
+func (r *squashfsReader) command(args ...string) *exec.Cmd {
+	args = append([]string{"-f", "-n", "-o", strconv.FormatInt(r.ai.Offset, 10)}, args...)
+	return exec.Command("unsquashfs", args...)
+}
+
+// Lines of unsquashfs -lls look like
+// lrwxrwxrwx root/root                 9 2020-05-20 10:00 squashfs-root/.DirIcon -> icon.png
+var unsquashfsListingLine = regexp.MustCompile(`^([-dlcbps][-rwxsStT]{9})\s+\S+\s+(\d+|\d+,\s*\d+)\s+(\d{4}-\d{2}-\d{2} \d{2}:\d{2})\s(.*)$`)
+
+func (r *squashfsReader) index() error {
+	if r.indexed {
+		return nil
+	}
+	out, err := runCommand(r.command("-lls", "-d", "squashfs-root", r.ai.Path), r.verbose)
+	if err != nil {
+		return err
+	}
+	scanner := bufio.NewScanner(bytes.NewReader(out.Bytes()))
+	for scanner.Scan() {
+		m := unsquashfsListingLine.FindStringSubmatch(scanner.Text())
+		if m == nil {
+			continue // Not a file, e.g., "Parallel unsquashfs: Using 8 processors"
+		}
+		mode, err := parseMode(m[1])
+		if err != nil {
+			continue
+		}
+		size, _ := strconv.ParseInt(m[2], 10, 64) // Devices list "major, minor" instead of a size
+		modTime, _ := time.ParseInLocation("2006-01-02 15:04", m[3], time.Local)
+		name, target := splitLinkTarget(mode, m[4])
+		name = strings.TrimPrefix(strings.TrimPrefix(name, "squashfs-root"), "/")
+		r.add(name, payloadFileInfo{size: size, mode: mode, modTime: modTime}, target)
+	}
+	r.indexed = true
+	return scanner.Err()
+}
+
+func (r *squashfsReader) Stat(name string) (os.FileInfo, error) {
+	if err := r.index(); err != nil {
+		return nil, err
+	}
+	return r.listingIndex.Stat(name)
+}
+
+func (r *squashfsReader) ReadDir(name string) ([]os.FileInfo, error) {
+	if err := r.index(); err != nil {
+		return nil, err
+	}
+	return r.listingIndex.ReadDir(name)
+}
+
+func (r *squashfsReader) Readlink(name string) (string, error) {
+	if err := r.index(); err != nil {
+		return "", err
+	}
+	return r.listingIndex.Readlink(name)
+}
+
+func (r *squashfsReader) Open(name string) (io.ReadCloser, error) {
+	dir, err := ioutil.TempDir("", "goappimage-squashfs-")
+	if err != nil {
+		return nil, err
+	}
+	root := filepath.Join(dir, "squashfs-root")
+	_, err = runCommand(r.command("-d", root, r.ai.Path, cleanPayloadName(name)), r.verbose)
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(root, cleanPayloadName(name)))
+	if err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+	return tempFileReadCloser{File: f, dir: dir}, nil
+}
+
+func (r *squashfsReader) Extract(pattern string, destinationdirpath string) error {
+	_, err := runCommand(r.command("-d", destinationdirpath, r.ai.Path, pattern), r.verbose)
+	return err
+}
+
+func (r *squashfsReader) List() (string, error) {
+	out, err := runCommand(r.command("-ll", "-d", "", r.ai.Path), r.verbose)
+	return out.String(), err
+}
+
+// Metadata reads the squashfs superblock directly, which is much faster than asking unsquashfs
+func (r *squashfsReader) Metadata() (PayloadMetadata, error) {
+	f, err := os.Open(r.ai.Path)
+	if err != nil {
+		return PayloadMetadata{}, err
+	}
+	defer f.Close()
+	sb, err := helpers.ReadSquashfsSuperblock(f, r.ai.Offset)
+	if err != nil {
+		return PayloadMetadata{}, err
+	}
+	return PayloadMetadata{
+		Format: PayloadSquashfs,
+		FSTime: time.Unix(int64(sb.ModTime), 0),
+		Size:   int64(sb.BytesUsed),
+	}, nil
+}
+
+func (r *squashfsReader) Close() error {
+	return nil
+}
@@ -0,0 +1,220 @@
+package goappimage
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// UpdateTarget is where the new version of an AppImage can be downloaded from
+type UpdateTarget struct {
+	URL   string
+	Zsync bool // URL points to a .zsync file rather than to the AppImage itself
+	// Client does the requests for URL and the file a .zsync file points to, with credentials if they need any.
+	// http.DefaultClient if nil.
+	Client *http.Client
+}
+
+func (t UpdateTarget) httpClient() *http.Client {
+	if t.Client != nil {
+		return t.Client
+	}
+	return http.DefaultClient
+}
+
+// UpdateTransport implements a transport mechanism of update information, the part before the first |.
+// Only ResolveURL is required. Hooks should return *UpdateInformationError for invalid update information,
+// other errors are reported as errors of the "transport" field.
+type UpdateTransport struct {
+	// Names of the fields taken after the name of the transport mechanism.
+	// If set, ParseUpdateInformation checks that there are exactly these fields and none of them is empty.
+	Fields []string
+	// Parse parses an updateinformation string starting with the name of the transport mechanism.
+	// If nil, it is split at each |.
+	Parse func(updateinformation string) (UpdateInformation, error)
+	// Format is the reverse of Parse, it returns the updateinformation string Parse gives ui for.
+	// Required if Parse is set, UpdateInformation.String joins the fields with | otherwise.
+	Format func(ui UpdateInformation) string
+	// Validate checks the parsed fields beyond what Fields is used for
+	Validate func(ui UpdateInformation) error
+	// ResolveURL returns where the new version can be downloaded from
+	ResolveURL func(ui UpdateInformation) (UpdateTarget, error)
+	// CheckForUpdate checks whether a new version of ai is available without downloading it.
+	// If nil, the header of the .zsync file is compared for zsync targets,
+	// and the size and Last-Modified header of the AppImage itself otherwise.
+	CheckForUpdate func(ai AppImage) (UpdateCheck, error)
+}
+
+var (
+	updateTransportsMu sync.RWMutex
+	updateTransports   = map[string]UpdateTransport{}
+)
+
+// RegisterUpdateTransport makes a transport mechanism available to ParseUpdateInformation, CheckForUpdate and Update.
+// Registering a transport mechanism a second time replaces the previous one.
+// It panics if t has a Parse hook but no Format hook.
+func RegisterUpdateTransport(name string, t UpdateTransport) {
+	if t.Parse != nil && t.Format == nil {
+		panic("goappimage: transport mechanism " + name + " has a Parse hook but no Format hook")
+	}
+	updateTransportsMu.Lock()
+	defer updateTransportsMu.Unlock()
+	updateTransports[name] = t
+}
+
+// unregisterUpdateTransport removes a transport mechanism, so that tests can clean up after themselves
+func unregisterUpdateTransport(name string) {
+	updateTransportsMu.Lock()
+	defer updateTransportsMu.Unlock()
+	delete(updateTransports, name)
+}
+
+func lookupUpdateTransport(name string) (UpdateTransport, bool) {
+	updateTransportsMu.RLock()
+	defer updateTransportsMu.RUnlock()
+	t, ok := updateTransports[name]
+	return t, ok
+}
+
+// parse parses updateinformation with the Parse hook of t, or splits it at each | if there is none
+func (t UpdateTransport) parse(updateinformation string) (UpdateInformation, error) {
+	if t.Parse == nil {
+		return splitUpdateInformation(updateinformation), nil
+	}
+	ui, err := t.Parse(updateinformation)
+	if err != nil {
+		return UpdateInformation{}, transportError(err)
+	}
+	return ui, nil
+}
+
+// validate checks ui against the Fields and with the Validate hook of t
+func (t UpdateTransport) validate(ui UpdateInformation) error {
+	if t.Fields != nil {
+		err := validateFieldCount(t, ui)
+		if err != nil {
+			return err
+		}
+	}
+	if t.Validate != nil {
+		err := t.Validate(ui)
+		if err != nil {
+			return transportError(err)
+		}
+	}
+	return nil
+}
+
+// The transport mechanisms of the AppImage specification,
+// https://github.com/AppImage/AppImageSpec/blob/master/draft.md#update-information
+func init() {
+	RegisterUpdateTransport("zsync", UpdateTransport{
+		Fields:   []string{"url"},
+		Validate: validateSpecFields,
+		ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+			return UpdateTarget{URL: ui.FileURL(), Zsync: true}, nil
+		},
+	})
+	RegisterUpdateTransport("gh-releases-zsync", UpdateTransport{
+		Fields:   []string{"username", "repository", "release", "filename"},
+		Validate: validateSpecFields,
+		ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+			target, _, err := ui.resolveGitHubReleases(DefaultGitHubClient, true)
+			return target, err
+		},
+	})
+	RegisterUpdateTransport("gh-releases-direct", UpdateTransport{
+		Fields:   []string{"username", "repository", "release", "filename"},
+		Validate: validateSpecFields,
+		ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+			target, _, err := ui.resolveGitHubReleases(DefaultGitHubClient, false)
+			return target, err
+		},
+		CheckForUpdate: checkGitHubDirectUpdate,
+	})
+	RegisterUpdateTransport("pling-v1-zsync", UpdateTransport{
+		Fields:   []string{"productid", "filename"},
+		Validate: validateSpecFields,
+		ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+			return ui.resolvePling(DefaultPlingClient)
+		},
+	})
+	// Not in the specification, for self-hosted update sources:
+	// gitlab-releases-*|<base URL>|<project path>|<release tag or latest>|<filename>
+	// http-directory-*|<URL of a directory index>|<filename, the newest version is used>
+	for _, suffix := range []string{"-zsync", "-direct"} {
+		zsync := suffix == "-zsync"
+		RegisterUpdateTransport("gitlab-releases"+suffix, UpdateTransport{
+			Fields:   []string{"baseurl", "project", "release", "filename"},
+			Validate: validateSpecFields,
+			ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+				return ui.resolveGitLabReleases(DefaultGitLabClient, zsync)
+			},
+		})
+		RegisterUpdateTransport("http-directory"+suffix, UpdateTransport{
+			Fields:   []string{"directory", "filename"},
+			Validate: validateSpecFields,
+			ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+				return ui.resolveDirectoryIndex(DefaultDirectoryIndexClient, zsync)
+			},
+		})
+	}
+	// Bintray is gone, but AppImages still carry it
+	RegisterUpdateTransport("bintray-zsync", UpdateTransport{
+		Fields:   []string{"username", "repository", "package", "filename"},
+		Validate: validateSpecFields,
+		ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+			return UpdateTarget{}, errors.New("Bintray has been shut down, " + ui.String() + " cannot be resolved")
+		},
+	})
+}
+
+// transportError turns an error of a transport hook into an *UpdateInformationError
+func transportError(err error) error {
+	var uiErr *UpdateInformationError
+	if errors.As(err, &uiErr) {
+		return err
+	}
+	return &UpdateInformationError{Field: "transport", Message: err.Error()}
+}
+
+// updateTransport returns the registered transport mechanism of ui
+func (ui UpdateInformation) updateTransport() (UpdateTransport, error) {
+	t, ok := lookupUpdateTransport(ui.Transport)
+	if !ok {
+		return t, errors.New("unknown transport mechanism \"" + ui.Transport + "\"")
+	}
+	return t, nil
+}
+
+// ResolveURL returns where the new version the update information points to can be downloaded from
+func (ui UpdateInformation) ResolveURL() (UpdateTarget, error) {
+	t, err := ui.updateTransport()
+	if err != nil {
+		return UpdateTarget{}, err
+	}
+	if t.ResolveURL == nil {
+		return UpdateTarget{}, errors.New("transport mechanism " + ui.Transport + " cannot resolve URLs")
+	}
+	target, err := t.ResolveURL(ui)
+	if err != nil {
+		return target, err
+	}
+	if strings.TrimSpace(target.URL) == "" {
+		return target, errors.New("transport mechanism " + ui.Transport + " resolved " + ui.String() + " to an empty URL")
+	}
+	return target, nil
+}
+
+// ResolveZsyncURL returns the URL of the .zsync file the update information points to
+func (ui UpdateInformation) ResolveZsyncURL() (string, error) {
+	target, err := ui.ResolveURL()
+	if err != nil {
+		return "", err
+	}
+	if !target.Zsync {
+		return "", errors.New("transport mechanism " + ui.Transport + " does not use zsync")
+	}
+	return target.URL, nil
+}
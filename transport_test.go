@@ -0,0 +1,145 @@
+package goappimage
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// The test-kv transport mechanism takes its fields as key=value pairs in any order,
+// e.g., "test-kv|file=App.AppImage;url=https://example.com"
+func init() {
+	RegisterUpdateTransport("test-kv", UpdateTransport{
+		Fields: []string{"url", "file"},
+		Parse: func(updateinformation string) (UpdateInformation, error) {
+			values := map[string]string{}
+			for _, kv := range strings.Split(strings.TrimPrefix(updateinformation, "test-kv|"), ";") {
+				i := strings.Index(kv, "=")
+				if i < 0 {
+					return UpdateInformation{}, errors.New("expected key=value, got " + kv)
+				}
+				values[kv[:i]] = kv[i+1:]
+			}
+			return UpdateInformation{Transport: "test-kv", Fields: []string{values["url"], values["file"]}}, nil
+		},
+		Format: func(ui UpdateInformation) string {
+			return "test-kv|file=" + ui.Fields[1] + ";url=" + ui.Fields[0]
+		},
+		Validate: func(ui UpdateInformation) error {
+			if !strings.HasPrefix(ui.Fields[0], "https://") {
+				return &UpdateInformationError{Field: "url", Message: "must be https"}
+			}
+			return nil
+		},
+		ResolveURL: func(ui UpdateInformation) (UpdateTarget, error) {
+			return UpdateTarget{URL: ui.Fields[0] + "/" + ui.Fields[1]}, nil
+		},
+	})
+}
+
+func TestTransportParseHook(t *testing.T) {
+	ui, err := ParseUpdateInformation("test-kv|file=App.AppImage;url=https://example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ui.Fields[0] != "https://example.com" || ui.Fields[1] != "App.AppImage" {
+		t.Errorf("Parse hook was not used: %+v", ui)
+	}
+	target, err := ui.ResolveURL()
+	if err != nil || target.URL != "https://example.com/App.AppImage" {
+		t.Errorf("resolved to %+v, %v", target, err)
+	}
+
+	embedded := parseEmbeddedUpdateInformation("test-kv|file=App.AppImage;url=http://example.com")
+	if embedded.Fields[0] != "http://example.com" {
+		t.Errorf("Parse hook was not used for embedded update information: %+v", embedded)
+	}
+	// Validate checks the fields as parsed, instead of parsing String() again
+	var uiErr *UpdateInformationError
+	if err = embedded.Validate(); !errors.As(err, &uiErr) || uiErr.Field != "url" {
+		t.Errorf("expected an error for url, got %v", err)
+	}
+	if err = ui.Validate(); err != nil {
+		t.Error(err)
+	}
+
+	// What cannot be parsed is kept as it is
+	broken := parseEmbeddedUpdateInformation("test-kv|garbage")
+	if broken.Transport != "test-kv" || len(broken.Fields) != 1 || broken.Fields[0] != "garbage" {
+		t.Errorf("unexpected %+v", broken)
+	}
+	if broken.String() != "test-kv|garbage" {
+		t.Errorf("%q does not give back what was embedded", broken.String())
+	}
+	if _, err = ParseUpdateInformation("test-kv|garbage"); !errors.As(err, &uiErr) || uiErr.Field != "transport" {
+		t.Errorf("expected an error for transport, got %v", err)
+	}
+}
+
+func TestTransportFormatHook(t *testing.T) {
+	for _, s := range []string{
+		"test-kv|file=App.AppImage;url=https://example.com",
+		"test-kv|url=https://example.com;file=App.AppImage",
+	} {
+		ui, err := ParseUpdateInformation(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := ParseUpdateInformation(ui.String())
+		if err != nil {
+			t.Fatalf("%q: %v", ui.String(), err)
+		}
+		if again.String() != ui.String() || again.Fields[0] != ui.Fields[0] || again.Fields[1] != ui.Fields[1] {
+			t.Errorf("%q parsed to %+v, want %+v", ui.String(), again, ui)
+		}
+	}
+	ui := UpdateInformation{Transport: "test-kv", Fields: []string{"https://example.com", "App.AppImage"}}
+	if ui.String() != "test-kv|file=App.AppImage;url=https://example.com" {
+		t.Errorf("formatted as %q", ui.String())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a Parse hook without a Format hook did not panic")
+		}
+	}()
+	RegisterUpdateTransport("test-parse-only", UpdateTransport{Parse: splitParse})
+}
+
+func splitParse(updateinformation string) (UpdateInformation, error) {
+	return splitUpdateInformation(updateinformation), nil
+}
+
+func TestValidateUnknownTransport(t *testing.T) {
+	var uiErr *UpdateInformationError
+	err := UpdateInformation{Transport: "foo", Fields: []string{"bar"}}.Validate()
+	if !errors.As(err, &uiErr) || uiErr.Field != "transport" {
+		t.Errorf("expected an error for transport, got %v", err)
+	}
+}
+
+func TestRegistriesAreSafeForConcurrentUse(t *testing.T) {
+	t.Cleanup(func() {
+		unregisterUpdateTransport("test-concurrent")
+		unregisterPayloadFormat("test-concurrent")
+	})
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterUpdateTransport("test-concurrent", UpdateTransport{})
+			RegisterPayloadFormat("test-concurrent", nil, nil, nil)
+		}()
+		go func() {
+			defer wg.Done()
+			ParseUpdateInformation("zsync|https://example.com/App.AppImage.zsync")
+			payloadProbes()
+		}()
+	}
+	wg.Wait()
+	if _, ok := lookupUpdateTransport("test-concurrent"); !ok {
+		t.Error("test-concurrent was not registered")
+	}
+}
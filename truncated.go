@@ -0,0 +1,58 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+)
+
+// ErrTruncated is returned for AppImages that are shorter than their filesystem image says they should be,
+// e.g., because a download or copy has not finished (yet)
+var ErrTruncated = errors.New("AppImage is truncated or incomplete")
+
+// CheckComplete compares the size the filesystem image claims for itself with the size of the file.
+// The result wraps ErrTruncated if the AppImage is incomplete, no matter what it is named.
+func (ai AppImage) CheckComplete() error {
+	f, err := os.Open(ai.Path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	var expected int64
+	switch ai.PayloadFormat {
+	case PayloadSquashfs:
+		sb, err := helpers.ReadSquashfsSuperblock(f, ai.Offset)
+		if err != nil {
+			return err
+		}
+		expected = ai.Offset + int64(sb.BytesUsed)
+	case PayloadISO9660:
+		vd, err := helpers.ReadISO9660VolumeDescriptor(f, ai.Offset)
+		if err != nil {
+			return err
+		}
+		expected = ai.Offset + vd.VolumeSize
+	case PayloadDwarfs:
+		size, err := helpers.DwarfsImageSize(f, ai.Offset, info.Size())
+		if err == io.ErrUnexpectedEOF {
+			return fmt.Errorf("%w: %s: DwarFS image ends after %d bytes", ErrTruncated, ai.Path, info.Size())
+		}
+		if err != nil {
+			return err
+		}
+		expected = ai.Offset + size
+	default:
+		return errors.New("unsupported payload format \"" + ai.PayloadFormat + "\" in " + ai.Path)
+	}
+	if info.Size() < expected {
+		return fmt.Errorf("%w: %s has %d bytes, expected at least %d", ErrTruncated, ai.Path, info.Size(), expected)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package goappimage
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+)
+
+// testSquashfs returns a squashfs image of size bytes that has nothing but a plausible superblock
+func testSquashfs(size int) []byte {
+	var sb bytes.Buffer
+	binary.Write(&sb, binary.LittleEndian, helpers.SquashfsSuperblock{
+		Magic:        [4]byte{'h', 's', 'q', 's'},
+		BlockSize:    1 << 17,
+		BlockLog:     17,
+		Compression:  1,
+		VersionMajor: 4,
+		BytesUsed:    uint64(size),
+	})
+	image := make([]byte, size)
+	copy(image, sb.Bytes())
+	return image
+}
+
+// testISO9660 returns an ISO9660 image of blocks 2048 byte blocks that has nothing but a primary volume descriptor
+func testISO9660(blocks int) []byte {
+	image := make([]byte, blocks*2048)
+	pvd := image[32768:]
+	pvd[0] = 1
+	copy(pvd[1:], "CD001")
+	binary.LittleEndian.PutUint32(pvd[80:], uint32(blocks))
+	binary.LittleEndian.PutUint16(pvd[128:], 2048)
+	return image
+}
+
+func TestCheckComplete(t *testing.T) {
+	tests := []struct {
+		format  string
+		payload []byte
+	}{
+		{PayloadSquashfs, testSquashfs(8192)},
+		{PayloadISO9660, testISO9660(20)},
+	}
+	for _, tt := range tests {
+		path, offset := writeTestELF(t, nil, tt.payload)
+		ai := AppImage{Path: path, ImageType: 2, Offset: offset, PayloadFormat: tt.format}
+		if err := ai.CheckComplete(); err != nil {
+			t.Errorf("%s: complete file: %v", tt.format, err)
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.Truncate(path, info.Size()-1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = ai.CheckComplete(); !errors.Is(err, ErrTruncated) {
+			t.Errorf("%s: cut short by one byte: got %v, want ErrTruncated", tt.format, err)
+		}
+	}
+}
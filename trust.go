@@ -0,0 +1,141 @@
+package goappimage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/adrg/xdg"
+)
+
+// Errors returned by KeyStore.CheckUpdate
+var (
+	ErrNotSigned  = errors.New("AppImage is not signed by a valid signature")
+	ErrKeyChanged = errors.New("AppImage is signed by a different key than the one pinned for it")
+)
+
+// DefaultKeyStorePath is where the signing keys pinned for AppImages are stored by default
+var DefaultKeyStorePath = xdg.DataHome + "/goappimage/pinned-keys.json"
+
+// PinnedKey is the signing key pinned for an identity
+type PinnedKey struct {
+	Fingerprint string
+	PinnedAt    time.Time
+}
+
+// KeyStore pins signing keys per AppImage identity (see Identity) on first use,
+// so that an update signed by a different key than the version it replaces is noticed.
+// With WarnOnly, key changes are logged instead of being reported as ErrKeyChanged.
+type KeyStore struct {
+	Path     string
+	WarnOnly bool
+	Keys     map[string]PinnedKey
+}
+
+// OpenKeyStore loads the KeyStore at path. A store that does not exist yet is empty.
+func OpenKeyStore(path string) (*KeyStore, error) {
+	ks := &KeyStore{Path: path, Keys: make(map[string]PinnedKey)}
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return ks, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(data, &ks.Keys)
+	if err != nil {
+		return nil, err
+	}
+	return ks, nil
+}
+
+// Save writes the KeyStore to its Path
+func (ks *KeyStore) Save() error {
+	data, err := json.MarshalIndent(ks.Keys, "", "\t")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(ks.Path), 0700)
+	if err != nil {
+		return err
+	}
+	tmp := ks.Path + ".tmp"
+	err = ioutil.WriteFile(tmp, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, ks.Path)
+}
+
+// Retrust explicitly pins fingerprint for identity, replacing whatever was pinned before.
+// This is how a deliberate key change by the author of an application is accepted.
+func (ks *KeyStore) Retrust(identity string, fingerprint string) {
+	ks.Keys[identity] = PinnedKey{Fingerprint: fingerprint, PinnedAt: time.Now()}
+}
+
+// Forget removes the pinned key for identity
+func (ks *KeyStore) Forget(identity string) {
+	delete(ks.Keys, identity)
+}
+
+// CheckUpdate checks that update is signed by the key pinned for the identity of current,
+// the version it is going to replace. If no key is pinned yet, the key current is signed with is pinned,
+// or the key of update if current is not signed. Call Save to keep newly pinned keys.
+// Returns ErrNotSigned if update is not validly signed, and ErrKeyChanged if it is signed by another key.
+func (ks *KeyStore) CheckUpdate(current AppImage, update AppImage) (SignatureResult, error) {
+	identity, err := current.Identity()
+	if err != nil {
+		return SignatureResult{}, err
+	}
+	res, err := update.VerifySignature(nil)
+	if err != nil {
+		return res, err
+	}
+	if !res.Valid {
+		return res, fmt.Errorf("%w: %s: %s", ErrNotSigned, update.Path, res.Reason)
+	}
+	pinned, ok := ks.Keys[identity]
+	if !ok {
+		pinned = PinnedKey{Fingerprint: res.Fingerprint, PinnedAt: time.Now()}
+		currentRes, err := current.VerifySignature(nil)
+		if err == nil && currentRes.Valid {
+			pinned.Fingerprint = currentRes.Fingerprint
+		}
+		ks.Keys[identity] = pinned
+	}
+	if pinned.Fingerprint != res.Fingerprint {
+		err = fmt.Errorf("%w: %s is signed by %s, but %s is pinned for %s", ErrKeyChanged, update.Path, res.Fingerprint, pinned.Fingerprint, identity)
+		if ks.WarnOnly {
+			log.Println("WARNING:", err)
+			return res, nil
+		}
+		return res, err
+	}
+	return res, nil
+}
+
+// Identity returns what identifies the application an AppImage belongs to across versions:
+// its update information if it has some, its AppStream id otherwise
+func (ai AppImage) Identity() (string, error) {
+	if !ai.UpdateInformation.IsZero() {
+		ui, err := url.QueryUnescape(ai.UpdateInformation.String())
+		if err != nil {
+			return ai.UpdateInformation.String(), nil
+		}
+		return ui, nil
+	}
+	as, err := ai.ReadAppStream(false)
+	if err != nil {
+		return "", errors.New(ai.Path + " has neither update information nor an AppStream id")
+	}
+	if as.ID == "" {
+		return "", errors.New(ai.Path + " has an AppStream file without id")
+	}
+	return "appstream:" + as.ID, nil
+}
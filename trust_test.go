@@ -0,0 +1,109 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"golang.org/x/crypto/openpgp"
+)
+
+// signedTestAppImage returns an AppImage of version with update information, signed by signer if it is not nil
+func signedTestAppImage(t *testing.T, signer *openpgp.Entity, version byte) AppImage {
+	t.Helper()
+	ai := writeSignableAppImage(t, version)
+	if signer != nil {
+		if err := ai.Sign(signer); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ai.UpdateInformation = UpdateInformation{Transport: "zsync", Fields: []string{"https://example.com/App.AppImage.zsync"}}
+	return ai
+}
+
+func TestKeyStoreCheckUpdate(t *testing.T) {
+	a := newTestEntity(t, "a")
+	b := newTestEntity(t, "b")
+	fingerprintA := fmt.Sprintf("%X", a.PrimaryKey.Fingerprint)
+	fingerprintB := fmt.Sprintf("%X", b.PrimaryKey.Fingerprint)
+	current := signedTestAppImage(t, a, 1)
+	identity, err := current.Identity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keys", "pinned-keys.json")
+	ks, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ks.Keys) != 0 {
+		t.Fatalf("a new KeyStore has keys: %v", ks.Keys)
+	}
+
+	// The key of current is pinned on first use, even if the update is signed by another one
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, b, 2)); !errors.Is(err, ErrKeyChanged) {
+		t.Errorf("expected ErrKeyChanged on first use, got %v", err)
+	}
+	if ks.Keys[identity].Fingerprint != fingerprintA {
+		t.Fatalf("pinned %v, want %s", ks.Keys[identity], fingerprintA)
+	}
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, a, 2)); err != nil {
+		t.Errorf("update signed by the pinned key: %v", err)
+	}
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, nil, 2)); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("expected ErrNotSigned for an unsigned update, got %v", err)
+	}
+
+	ks.WarnOnly = true
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, b, 2)); err != nil {
+		t.Errorf("WarnOnly: %v", err)
+	}
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, nil, 2)); !errors.Is(err, ErrNotSigned) {
+		t.Errorf("WarnOnly: expected ErrNotSigned for an unsigned update, got %v", err)
+	}
+	if ks.Keys[identity].Fingerprint != fingerprintA {
+		t.Errorf("WarnOnly changed the pinned key to %v", ks.Keys[identity])
+	}
+	ks.WarnOnly = false
+
+	ks.Retrust(identity, fingerprintB)
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, b, 2)); err != nil {
+		t.Errorf("update signed by the retrusted key: %v", err)
+	}
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, a, 2)); !errors.Is(err, ErrKeyChanged) {
+		t.Errorf("expected ErrKeyChanged for the key pinned before Retrust, got %v", err)
+	}
+
+	if err = ks.Save(); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := OpenKeyStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(loaded.Keys) != 1 || loaded.Keys[identity].Fingerprint != fingerprintB ||
+		!loaded.Keys[identity].PinnedAt.Equal(ks.Keys[identity].PinnedAt) {
+		t.Errorf("loaded %v, saved %v", loaded.Keys, ks.Keys)
+	}
+	loaded.Forget(identity)
+	if len(loaded.Keys) != 0 {
+		t.Errorf("Forget left %v", loaded.Keys)
+	}
+}
+
+func TestKeyStorePinsTheUpdateKeyForUnsignedAppImages(t *testing.T) {
+	a := newTestEntity(t, "a")
+	current := signedTestAppImage(t, nil, 1)
+	ks, err := OpenKeyStore(filepath.Join(t.TempDir(), "pinned-keys.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = ks.CheckUpdate(current, signedTestAppImage(t, a, 2)); err != nil {
+		t.Fatal(err)
+	}
+	identity, _ := current.Identity()
+	if want := fmt.Sprintf("%X", a.PrimaryKey.Fingerprint); ks.Keys[identity].Fingerprint != want {
+		t.Errorf("pinned %v, want %s", ks.Keys[identity], want)
+	}
+}
@@ -0,0 +1,159 @@
+package goappimage
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+
+	"github.com/CalebQ42/GoAppImage/internal/zsync"
+)
+
+// UpdateCheck is the result of CheckForUpdate
+type UpdateCheck struct {
+	Available bool
+	Filename  string // Name of the remote file
+	Size      int64
+	MTime     time.Time
+	Target    UpdateTarget
+}
+
+// fetchZsyncHeader downloads only as much of the .zsync file at zsyncURL as is needed for its header
+func fetchZsyncHeader(client *http.Client, zsyncURL string) (*zsync.ControlFile, error) {
+	req, err := http.NewRequest(http.MethodGet, zsyncURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	// The header is a few hundred bytes, servers that ignore this get their connection closed early
+	req.Header.Set("Range", "bytes=0-8191")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return nil, fmt.Errorf("%s: %s", zsyncURL, resp.Status)
+	}
+	return zsync.ParseHeader(resp.Body)
+}
+
+// CheckForUpdate checks whether a newer version of the AppImage is available without downloading it,
+// using the CheckForUpdate hook of its transport mechanism
+func CheckForUpdate(ai AppImage) (UpdateCheck, error) {
+	if ai.UpdateInformation.IsZero() {
+		return UpdateCheck{}, errors.New(ai.Path + " has no update information")
+	}
+	t, err := ai.UpdateInformation.updateTransport()
+	if err != nil {
+		return UpdateCheck{}, err
+	}
+	if t.CheckForUpdate != nil {
+		return t.CheckForUpdate(ai)
+	}
+	target, err := ai.UpdateInformation.ResolveURL()
+	if err != nil {
+		return UpdateCheck{}, err
+	}
+	if target.Zsync {
+		return checkZsyncUpdate(ai, target)
+	}
+	return checkDirectUpdate(ai, target)
+}
+
+// checkZsyncUpdate downloads only the header of the .zsync file,
+// and compares the length and SHA-1 in it with the local file.
+// The mtime of the remote file is reported, but not used to decide, since the mtime of the local file
+// is when it was downloaded rather than when it was built.
+func checkZsyncUpdate(ai AppImage, target UpdateTarget) (UpdateCheck, error) {
+	header, err := fetchZsyncHeader(target.httpClient(), target.URL)
+	if err != nil {
+		return UpdateCheck{}, err
+	}
+	check := UpdateCheck{
+		Filename: header.Filename,
+		Size:     header.Length,
+		MTime:    header.MTime,
+		Target:   target,
+	}
+	info, err := os.Stat(ai.Path)
+	if err != nil {
+		return check, err
+	}
+	// Different lengths are cheap to spot, the SHA-1 is only needed if they match
+	if info.Size() != header.Length {
+		check.Available = true
+		return check, nil
+	}
+	sum, err := sha1File(ai.Path)
+	if err != nil {
+		return check, err
+	}
+	check.Available = sum != header.SHA1
+	return check, nil
+}
+
+// checkDirectUpdate asks for the headers of the remote AppImage. Without a checksum to compare,
+// an update is available if the size differs or the remote file was modified after the local one was written.
+func checkDirectUpdate(ai AppImage, target UpdateTarget) (UpdateCheck, error) {
+	resp, err := target.httpClient().Head(target.URL)
+	if err != nil {
+		return UpdateCheck{}, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return UpdateCheck{}, fmt.Errorf("%s: %s", target.URL, resp.Status)
+	}
+	check := UpdateCheck{
+		Filename: path.Base(resp.Request.URL.Path),
+		Size:     resp.ContentLength,
+		Target:   target,
+	}
+	check.MTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	check.Available, err = directUpdateAvailable(ai, check.Size, check.MTime)
+	return check, err
+}
+
+// checkGitHubDirectUpdate uses the size and modification time GitHub reports for the asset
+// gh-releases-direct update information points to
+func checkGitHubDirectUpdate(ai AppImage) (UpdateCheck, error) {
+	target, asset, err := ai.UpdateInformation.resolveGitHubReleases(DefaultGitHubClient, false)
+	if err != nil {
+		return UpdateCheck{}, err
+	}
+	check := UpdateCheck{
+		Filename: asset.Name,
+		Size:     asset.Size,
+		MTime:    asset.UpdatedAt,
+		Target:   target,
+	}
+	check.Available, err = directUpdateAvailable(ai, check.Size, check.MTime)
+	return check, err
+}
+
+// directUpdateAvailable compares the size (-1 if unknown) and mtime (zero if unknown) of a remote AppImage with the local one
+func directUpdateAvailable(ai AppImage, size int64, mtime time.Time) (bool, error) {
+	info, err := os.Stat(ai.Path)
+	if err != nil {
+		return false, err
+	}
+	return (size >= 0 && size != info.Size()) || mtime.After(info.ModTime()), nil
+}
+
+func sha1File(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha1.New()
+	_, err = io.Copy(h, f)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,329 @@
+package goappimage
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// updateinformation started out as a string that tells AppImageUpdate where to grab updates from.
+// Turns out that it can also be used to identify a set of AppImages that belong together
+// among which it makes sense to compare version numbers. Because it identifies the author,
+// "channel" (e.g., continuous,...)
+// Hence we are using it as the main identifier for AppImages now, similar
+// to how the Play Store uses strings like "com.spotify.music" to identify apps.
+
+// For example, if the system wants to update an application,
+// we search for the newest AppImage that has update information of the updater.
+// This way, no matter how many versions of the updater are on the system,
+// we are using the most recent one.
+// This is kinda replicating Launch Services behavior using XDG standards.
+
+// TODO: Eventually use ValidateUpdateInformation in AppImageHub, too
+
+// Please note that pre-releases are not being considered when using "latest".
+// You will have to explicitly provide the name of a release.
+// When using e.g., uploadtool, the name of the release created will
+// always be "continuous",
+// hence, you can just specify that value instead of "latest".
+
+// UpdateInformation is parsed update information, e.g.,
+// "gh-releases-zsync|probonopd|go-appimage|continuous|appimaged-*-x86_64.AppImage.zsync".
+// Fields holds everything after the transport mechanism in the order it appears in,
+// what the fields mean depends on the transport mechanism and is available through the accessors.
+// The zero value is "no update information".
+type UpdateInformation struct {
+	Transport string
+	Fields    []string
+	// raw is the update information as embedded if the transport mechanism could not parse it,
+	// so that String gives back what the AppImage contains
+	raw string
+}
+
+// ParseUpdateInformation parses and validates an updateinformation string
+// using the registered transport mechanism it starts with
+func ParseUpdateInformation(updateinformation string) (UpdateInformation, error) {
+	name := transportName(updateinformation)
+	t, ok := lookupUpdateTransport(name)
+	if !ok {
+		return UpdateInformation{}, unknownTransportError(name)
+	}
+	ui, err := t.parse(updateinformation)
+	if err != nil {
+		return UpdateInformation{}, err
+	}
+	err = t.validate(ui)
+	if err != nil {
+		return UpdateInformation{}, err
+	}
+	return ui, nil
+}
+
+// parseEmbeddedUpdateInformation parses the update information of an AppImage without validating it,
+// so that we can keep what AppImages contain even if it is invalid
+func parseEmbeddedUpdateInformation(updateinformation string) UpdateInformation {
+	if t, ok := lookupUpdateTransport(transportName(updateinformation)); ok {
+		if ui, err := t.parse(updateinformation); err == nil {
+			return ui
+		}
+	}
+	ui := splitUpdateInformation(updateinformation)
+	ui.raw = updateinformation
+	return ui
+}
+
+// transportName returns the name of the transport mechanism updateinformation starts with
+func transportName(updateinformation string) string {
+	return strings.SplitN(updateinformation, "|", 2)[0]
+}
+
+func unknownTransportError(name string) error {
+	return &UpdateInformationError{Field: "transport", Message: "unknown transport mechanism \"" + name + "\""}
+}
+
+// splitUpdateInformation splits updateinformation at each |
+func splitUpdateInformation(updateinformation string) UpdateInformation {
+	if updateinformation == "" {
+		return UpdateInformation{}
+	}
+	parts := strings.Split(updateinformation, "|")
+	return UpdateInformation{Transport: parts[0], Fields: parts[1:]}
+}
+
+// String returns the updateinformation string, parsing it again gives the same UpdateInformation.
+// Transport mechanisms with a Parse hook format it with their Format hook.
+func (ui UpdateInformation) String() string {
+	if ui.Transport == "" {
+		return ""
+	}
+	if ui.raw != "" {
+		return ui.raw
+	}
+	if t, ok := lookupUpdateTransport(ui.Transport); ok && t.Format != nil {
+		return t.Format(ui)
+	}
+	return strings.Join(append([]string{ui.Transport}, ui.Fields...), "|")
+}
+
+// IsZero returns true if there is no update information
+func (ui UpdateInformation) IsZero() bool {
+	return ui.Transport == "" && len(ui.Fields) == 0
+}
+
+// Validate validates the update information like ValidateUpdateInformation,
+// using the fields as they are rather than parsing String() again
+func (ui UpdateInformation) Validate() error {
+	t, ok := lookupUpdateTransport(ui.Transport)
+	if !ok {
+		return unknownTransportError(ui.Transport)
+	}
+	return t.validate(ui)
+}
+
+func (ui UpdateInformation) field(i int) string {
+	if i < len(ui.Fields) {
+		return ui.Fields[i]
+	}
+	return ""
+}
+
+// FileURL returns the URL of the zsync file for the zsync transport mechanism
+func (ui UpdateInformation) FileURL() string {
+	if ui.Transport == "zsync" {
+		return ui.field(0)
+	}
+	return ""
+}
+
+// isGitHubReleases returns true for the transport mechanisms that use GitHub Releases
+func (ui UpdateInformation) isGitHubReleases() bool {
+	return ui.Transport == "gh-releases-zsync" || ui.Transport == "gh-releases-direct"
+}
+
+// isGitLabReleases returns true for the transport mechanisms that use GitLab Releases
+func (ui UpdateInformation) isGitLabReleases() bool {
+	return ui.Transport == "gitlab-releases-zsync" || ui.Transport == "gitlab-releases-direct"
+}
+
+// isDirectoryIndex returns true for the transport mechanisms that use an HTTP directory index
+func (ui UpdateInformation) isDirectoryIndex() bool {
+	return ui.Transport == "http-directory-zsync" || ui.Transport == "http-directory-direct"
+}
+
+// Username returns the user or organization the repository belongs to
+func (ui UpdateInformation) Username() string {
+	if ui.isGitHubReleases() || ui.Transport == "bintray-zsync" {
+		return ui.field(0)
+	}
+	return ""
+}
+
+// Repository returns the name of the repository
+func (ui UpdateInformation) Repository() string {
+	if ui.isGitHubReleases() || ui.Transport == "bintray-zsync" {
+		return ui.field(1)
+	}
+	return ""
+}
+
+// ReleaseName returns the name of the release, "latest" meaning the latest release as determined by the GitHub
+// or GitLab API
+func (ui UpdateInformation) ReleaseName() string {
+	if ui.isGitHubReleases() || ui.isGitLabReleases() {
+		return ui.field(2)
+	}
+	return ""
+}
+
+// PackageName returns the name of the package for the bintray-zsync transport mechanism
+func (ui UpdateInformation) PackageName() string {
+	if ui.Transport == "bintray-zsync" {
+		return ui.field(2)
+	}
+	return ""
+}
+
+// ProductID returns the Pling product id for the pling-v1-zsync transport mechanism
+func (ui UpdateInformation) ProductID() string {
+	if ui.Transport == "pling-v1-zsync" {
+		return ui.field(0)
+	}
+	return ""
+}
+
+// Filename returns the filename of the zsync file in the release or package, a pattern for MatchUpdateFilename.
+// For the *-direct transport mechanisms, this is the filename of the AppImage itself.
+func (ui UpdateInformation) Filename() string {
+	switch {
+	case ui.isGitHubReleases() || ui.isGitLabReleases() || ui.Transport == "bintray-zsync":
+		return ui.field(3) // a.k.a. "zsync path" for bintray-zsync
+	case ui.Transport == "pling-v1-zsync" || ui.isDirectoryIndex():
+		return ui.field(1)
+	}
+	return ""
+}
+
+// UpdateInformationError is returned for invalid update information.
+// Field names the part of the update information that is wrong, e.g., "transport" or "filename".
+type UpdateInformationError struct {
+	Field   string
+	Message string
+}
+
+func (e *UpdateInformationError) Error() string {
+	return "invalid update information: " + e.Field + ": " + e.Message
+}
+
+// ValidateUpdateInformation validates an updateinformation string using its registered transport mechanism,
+// returns an *UpdateInformationError naming the field that is wrong.
+func ValidateUpdateInformation(updateinformation string) error {
+	_, err := ParseUpdateInformation(updateinformation)
+	return err
+}
+
+// validateFieldCount checks that ui has the fields t takes, none of them empty
+func validateFieldCount(t UpdateTransport, ui UpdateInformation) error {
+	if len(ui.Fields) != len(t.Fields) {
+		return &UpdateInformationError{Field: "transport", Message: fmt.Sprintf("%s takes %d fields (%s), got %d",
+			ui.Transport, len(t.Fields), strings.Join(t.Fields, "|"), len(ui.Fields))}
+	}
+	for i, field := range t.Fields {
+		value := ui.Fields[i]
+		if value == "" {
+			return &UpdateInformationError{Field: field, Message: "is empty"}
+		}
+		if strings.TrimSpace(value) != value {
+			return &UpdateInformationError{Field: field, Message: "has leading or trailing whitespace"}
+		}
+	}
+	return nil
+}
+
+// validateSpecFields checks the fields of the built-in transport mechanisms by their names
+func validateSpecFields(ui UpdateInformation) error {
+	t, _ := lookupUpdateTransport(ui.Transport)
+	for i, field := range t.Fields {
+		value := ui.Fields[i]
+		var err error
+		switch field {
+		case "url":
+			err = validateZsyncURL(value)
+		case "baseurl", "directory":
+			err = validateHTTPURL(value)
+		case "project":
+			if strings.HasPrefix(value, "/") || strings.HasSuffix(value, "/") || strings.Contains(value, "//") {
+				err = errors.New("must be a path like group/project")
+			}
+		case "username", "repository", "package", "release":
+			if strings.Contains(value, "/") {
+				err = errors.New("must not contain /")
+			}
+		case "productid":
+			if _, convErr := strconv.ParseUint(value, 10, 64); convErr != nil {
+				err = errors.New("must be numeric")
+			}
+		case "filename":
+			err = validateUpdateFilename(value, !strings.HasSuffix(ui.Transport, "-direct"))
+		}
+		if err != nil {
+			return &UpdateInformationError{Field: field, Message: err.Error()}
+		}
+	}
+	return nil
+}
+
+// validateZsyncURL checks the URL of the zsync transport mechanism.
+// Note that it is allowable to have something like "some.zsync?foo=bar", which is why we parse it as an URL
+func validateZsyncURL(value string) error {
+	err := validateHTTPURL(value)
+	if err != nil {
+		return err
+	}
+	u, _ := url.Parse(value)
+	if !strings.HasSuffix(u.Path, ".zsync") {
+		return errors.New(value + " does not end in .zsync")
+	}
+	return nil
+}
+
+// validateHTTPURL checks that value is an absolute http or https URL
+func validateHTTPURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil {
+		return errors.New("cannot parse URL: " + err.Error())
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return errors.New("scheme is missing, needs e.g., http:// or https://")
+	}
+	if u.Host == "" {
+		return errors.New("host is missing")
+	}
+	return nil
+}
+
+// MatchUpdateFilename reports whether name matches the filename pattern of update information.
+// Patterns have the syntax of path.Match: * matches any run of characters, ? matches a single character
+// and [...] a character class. Filenames have no query string, so ? is always a wildcard.
+func MatchUpdateFilename(pattern string, name string) (bool, error) {
+	return path.Match(pattern, name)
+}
+
+// validateUpdateFilename checks a filename pattern, see MatchUpdateFilename
+func validateUpdateFilename(value string, zsync bool) error {
+	if strings.Contains(value, "/") {
+		return errors.New("must be a filename, not a URL or path")
+	}
+	if _, err := MatchUpdateFilename(value, ""); err != nil {
+		return errors.New(value + " is not a valid pattern: " + err.Error())
+	}
+	if zsync && !strings.HasSuffix(value, ".zsync") {
+		return errors.New(value + " does not end in .zsync")
+	}
+	if !zsync && strings.HasSuffix(value, ".zsync") {
+		return errors.New(value + " must name the AppImage itself, not its .zsync file")
+	}
+	return nil
+}
@@ -0,0 +1,167 @@
+package goappimage
+
+import (
+	"errors"
+	"net/url"
+	"path"
+	"testing"
+)
+
+func TestParseUpdateInformation(t *testing.T) {
+	// field is the Field of the expected *UpdateInformationError, "" if the update information is valid
+	tests := []struct {
+		ui    string
+		field string
+	}{
+		{"", "transport"},
+		{"foo|bar", "transport"},
+		{"ZSYNC|https://example.com/App.AppImage.zsync", "transport"},
+
+		{"zsync|https://example.com/App.AppImage.zsync", ""},
+		{"zsync|http://example.com/dir/App.AppImage.zsync", ""},
+		{"zsync|https://example.com/App.AppImage.zsync?foo=bar", ""},
+		{"zsync|example.com/App.AppImage.zsync", "url"},
+		{"zsync|ftp://example.com/App.AppImage.zsync", "url"},
+		{"zsync|https:///App.AppImage.zsync", "url"},
+		{"zsync|https://example.com/App.AppImage", "url"},
+		{"zsync|https://example.com/App.AppImage?file=App.AppImage.zsync", "url"},
+		{"zsync|", "url"},
+		{"zsync| https://example.com/App.AppImage.zsync", "url"},
+		{"zsync", "transport"},
+		{"zsync|https://example.com/a.zsync|https://example.com/b.zsync", "transport"},
+
+		{"gh-releases-zsync|probonopd|go-appimage|continuous|appimaged-*-x86_64.AppImage.zsync", ""},
+		{"gh-releases-zsync|probonopd|go-appimage|latest|appimaged-*-x86_64.AppImage.zsync", ""},
+		{"gh-releases-zsync|probonopd|go-appimage|continuous", "transport"},
+		{"gh-releases-zsync||go-appimage|continuous|a.AppImage.zsync", "username"},
+		{"gh-releases-zsync|probonopd/x|go-appimage|continuous|a.AppImage.zsync", "username"},
+		{"gh-releases-zsync|probonopd|go/appimage|continuous|a.AppImage.zsync", "repository"},
+		{"gh-releases-zsync|probonopd|go-appimage|v1/2|a.AppImage.zsync", "release"},
+		{"gh-releases-zsync|a|b|latest|App-?.AppImage.zsync", ""},
+		{"gh-releases-zsync|a|b|latest|App-[0-9]*.AppImage.zsync", ""},
+		{"gh-releases-zsync|a|b|latest|App-[0-9.AppImage.zsync", "filename"},
+		{"gh-releases-zsync|a|b|latest|App.AppImage.zsync?foo=bar", "filename"},
+		{"gh-releases-zsync|probonopd|go-appimage|continuous|appimaged-x86_64.AppImage", "filename"},
+		{"gh-releases-zsync|probonopd|go-appimage|continuous|dir/a.AppImage.zsync", "filename"},
+		{"gh-releases-zsync|probonopd|go-appimage|continuous|https://example.com/a.AppImage.zsync", "filename"},
+
+		{"gh-releases-direct|probonopd|go-appimage|continuous|appimaged-*-x86_64.AppImage", ""},
+		{"gh-releases-direct|probonopd|go-appimage|continuous|appimaged-*-x86_64.AppImage.zsync", "filename"},
+		{"gh-releases-direct|probonopd|go-appimage|continuous", "transport"},
+
+		{"pling-v1-zsync|1234567|App-*-x86_64.AppImage.zsync", ""},
+		{"pling-v1-zsync|app|App-*-x86_64.AppImage.zsync", "productid"},
+		{"pling-v1-zsync|-1|App-*-x86_64.AppImage.zsync", "productid"},
+		{"pling-v1-zsync|1234567|App-*-x86_64.AppImage", "filename"},
+		{"pling-v1-zsync|1234567", "transport"},
+
+		{"gitlab-releases-zsync|https://gitlab.com|group/subgroup/project|latest|App-*.AppImage.zsync", ""},
+		{"gitlab-releases-direct|https://gitlab.example.com/|group/project|v1.0|App-*.AppImage", ""},
+		{"gitlab-releases-zsync|gitlab.com|group/project|latest|App-*.AppImage.zsync", "baseurl"},
+		{"gitlab-releases-zsync|https://gitlab.com|/group/project|latest|App-*.AppImage.zsync", "project"},
+		{"gitlab-releases-zsync|https://gitlab.com|group/project/|latest|App-*.AppImage.zsync", "project"},
+		{"gitlab-releases-zsync|https://gitlab.com|group//project|latest|App-*.AppImage.zsync", "project"},
+		{"gitlab-releases-zsync|https://gitlab.com|group/project|v1/0|App-*.AppImage.zsync", "release"},
+		{"gitlab-releases-direct|https://gitlab.com|group/project|latest|App-*.AppImage.zsync", "filename"},
+
+		{"http-directory-zsync|https://example.com/releases/|App-*.AppImage.zsync", ""},
+		{"http-directory-direct|https://example.com/releases/|App-*.AppImage", ""},
+		{"http-directory-zsync|/releases/|App-*.AppImage.zsync", "directory"},
+		{"http-directory-direct|https://example.com/releases/|App-*.AppImage.zsync", "filename"},
+		{"http-directory-zsync|https://example.com/releases/", "transport"},
+
+		{"bintray-zsync|user|repo|package|App-_latestVersion-x86_64.AppImage.zsync", ""},
+		{"bintray-zsync|user|repo|pack/age|App-_latestVersion-x86_64.AppImage.zsync", "package"},
+		{"bintray-zsync|user|repo|package|App-_latestVersion-x86_64.AppImage", "filename"},
+	}
+	for _, tt := range tests {
+		ui, err := ParseUpdateInformation(tt.ui)
+		if tt.field == "" {
+			if err != nil {
+				t.Errorf("%q: %v", tt.ui, err)
+			} else if ui.String() != tt.ui {
+				t.Errorf("%q: parsed to %q", tt.ui, ui.String())
+			}
+			continue
+		}
+		var uiErr *UpdateInformationError
+		if !errors.As(err, &uiErr) {
+			t.Errorf("%q: expected an *UpdateInformationError for %s, got %v", tt.ui, tt.field, err)
+			continue
+		}
+		if uiErr.Field != tt.field {
+			t.Errorf("%q: error for field %s, want %s: %v", tt.ui, uiErr.Field, tt.field, err)
+		}
+	}
+}
+
+func TestUpdateInformationAccessors(t *testing.T) {
+	ui, err := ParseUpdateInformation("gh-releases-zsync|probonopd|go-appimage|continuous|appimaged-*-x86_64.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ui.Username() != "probonopd" || ui.Repository() != "go-appimage" || ui.ReleaseName() != "continuous" ||
+		ui.Filename() != "appimaged-*-x86_64.AppImage.zsync" || ui.FileURL() != "" || ui.ProductID() != "" {
+		t.Errorf("unexpected accessors for %q", ui)
+	}
+	ui, err = ParseUpdateInformation("pling-v1-zsync|1234567|App-*-x86_64.AppImage.zsync")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ui.ProductID() != "1234567" || ui.Filename() != "App-*-x86_64.AppImage.zsync" || ui.Username() != "" {
+		t.Errorf("unexpected accessors for %q", ui)
+	}
+	if !(UpdateInformation{}).IsZero() || (UpdateInformation{}).String() != "" {
+		t.Error("the zero UpdateInformation is not empty")
+	}
+}
+
+func TestMatchUpdateFilename(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		match   bool
+	}{
+		{"App-*-x86_64.AppImage.zsync", "App-1.2.3-x86_64.AppImage.zsync", true},
+		{"App-*-x86_64.AppImage.zsync", "App-1.2.3-aarch64.AppImage.zsync", false},
+		{"App-?.AppImage", "App-1.AppImage", true},
+		{"App-?.AppImage", "App-12.AppImage", false},
+		{"App-?.AppImage", "App-.AppImage", false},
+		{"App-[0-9]*.AppImage", "App-2.0.AppImage", true},
+		{"App-[0-9]*.AppImage", "App-beta.AppImage", false},
+		{"App.AppImage", "App.AppImage", true},
+	}
+	for _, tt := range tests {
+		match, err := MatchUpdateFilename(tt.pattern, tt.name)
+		if err != nil {
+			t.Errorf("%q: %v", tt.pattern, err)
+		} else if match != tt.match {
+			t.Errorf("%q matches %q: %v, want %v", tt.pattern, tt.name, match, tt.match)
+		}
+	}
+	if _, err := MatchUpdateFilename("App-[", "App-["); err == nil {
+		t.Error("expected an error for a malformed pattern")
+	}
+}
+
+func TestFindWithSingleCharacterWildcard(t *testing.T) {
+	gh := &GitHubRelease{TagName: "v1", Assets: []GitHubAsset{{Name: "App-10.AppImage.zsync"}, {Name: "App-1.AppImage.zsync"}}}
+	if a, err := gh.FindAsset("App-?.AppImage.zsync"); err != nil || a.Name != "App-1.AppImage.zsync" {
+		t.Errorf("GitHub: %v, %v", a, err)
+	}
+	gl := &GitLabRelease{TagName: "v1"}
+	gl.Assets.Links = []GitLabAssetLink{{Name: "App-10.AppImage"}, {Name: "App-1.AppImage"}}
+	if l, err := gl.FindAsset("App-?.AppImage"); err != nil || l.Name != "App-1.AppImage" {
+		t.Errorf("GitLab: %v, %v", l, err)
+	}
+	if f, err := FindPlingFile([]PlingFile{{Name: "App-1.AppImage.zsync"}, {Name: "App-10.AppImage.zsync"}}, "App-?.AppImage.zsync"); err != nil || f.Name != "App-1.AppImage.zsync" {
+		t.Errorf("Pling: %v, %v", f, err)
+	}
+	var files []*url.URL
+	for _, name := range []string{"App-1.AppImage", "App-2.AppImage", "App-10.AppImage"} {
+		files = append(files, &url.URL{Scheme: "https", Host: "example.com", Path: "/releases/" + name})
+	}
+	if u, err := FindNewestFile(files, "App-?.AppImage"); err != nil || path.Base(u.Path) != "App-2.AppImage" {
+		t.Errorf("directory index: %v, %v", u, err)
+	}
+}
@@ -0,0 +1,246 @@
+package goappimage
+
+import (
+	"errors"
+	"io/ioutil"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/CalebQ42/GoAppImage/internal/helpers"
+	"gopkg.in/ini.v1"
+)
+
+// IDs of the checks done by Validate
+const (
+	CheckUpdateInformation = "update-information"
+	CheckDesktopFile       = "desktop-file"
+	CheckIcon              = "icon"
+	CheckAppRun            = "apprun"
+	CheckPayloadOffset     = "payload-offset"
+	CheckTruncated         = "truncated"
+	CheckSignature         = "signature"
+	CheckAppStream         = "appstream"
+)
+
+// Finding is a problem found by one of the checks of Validate
+type Finding struct {
+	CheckID string
+	Message string
+}
+
+// ValidationReport is the result of Validate. An AppImage without Errors is valid,
+// Warnings are about things that should be improved but do not break the AppImage.
+type ValidationReport struct {
+	Path     string
+	Errors   []Finding
+	Warnings []Finding
+}
+
+// Valid returns true if no check found an error
+func (r ValidationReport) Valid() bool {
+	return len(r.Errors) == 0
+}
+
+func (r *ValidationReport) addError(checkID string, message string) {
+	r.Errors = append(r.Errors, Finding{CheckID: checkID, Message: message})
+}
+
+func (r *ValidationReport) addWarning(checkID string, message string) {
+	r.Warnings = append(r.Warnings, Finding{CheckID: checkID, Message: message})
+}
+
+// Validate checks the quality of an AppImage and returns a report of everything that is wrong with it.
+// Returns error only if the AppImage could not be checked at all.
+// TODO: Reuse this in appimagetool
+func (ai AppImage) Validate(verbose bool) (ValidationReport, error) {
+	report := ValidationReport{Path: ai.Path}
+	if verbose == true {
+		log.Println("Validating AppImage", ai.Path)
+	}
+	if ai.ImageType < 1 {
+		// Truncated AppImages are not opened as AppImages, have another look to tell them apart
+		return report, ai.validateUnopened(&report)
+	}
+
+	// Check validity of the updateinformation in this AppImage, if it contains some
+	if ai.UpdateInformation.IsZero() {
+		report.addWarning(CheckUpdateInformation, "no update information, the AppImage cannot be updated")
+	} else if err := ai.UpdateInformation.Validate(); err != nil {
+		report.addError(CheckUpdateInformation, err.Error())
+	}
+
+	ai.validatePayloadOffset(&report)
+	if err := ai.CheckComplete(); err != nil {
+		report.addError(CheckTruncated, err.Error())
+		// Everything else needs the payload, which is not going to work out
+		return report, nil
+	}
+
+	payload, err := ai.OpenPayload(verbose)
+	if err != nil {
+		return report, err
+	}
+	defer payload.Close()
+	desktop := validateDesktopFile(payload, &report)
+	validateIcon(payload, desktop, &report)
+	validateAppRun(payload, &report)
+
+	res, err := ai.VerifySignature(nil)
+	if err != nil {
+		report.addError(CheckSignature, err.Error())
+	} else if !res.Signed {
+		report.addWarning(CheckSignature, "AppImage is not signed")
+	} else if !res.Valid {
+		report.addError(CheckSignature, "invalid signature: "+res.Reason)
+	}
+
+	_, err = readAppStream(payload)
+	if err == ErrNoAppStream {
+		report.addWarning(CheckAppStream, "no AppStream metadata in "+strings.Join(appStreamDirs, " or "))
+	} else if err != nil {
+		report.addError(CheckAppStream, err.Error())
+	}
+	return report, nil
+}
+
+// validateUnopened reports why an AppImage that openAppImage gave up on cannot be used.
+// Returns error if it is not an AppImage at all.
+func (ai AppImage) validateUnopened(report *ValidationReport) error {
+	ai.ImageType = ai.determineImageType()
+	if ai.ImageType < 1 {
+		return errors.New(ai.Path + " is not an AppImage")
+	}
+	if ai.ImageType == 1 {
+		ai.PayloadFormat = PayloadISO9660
+	} else {
+		offset, err := ai.FindPayloadOffset()
+		if err != nil {
+			report.addError(CheckPayloadOffset, err.Error())
+			return nil
+		}
+		ai.Offset = offset
+		ai.PayloadFormat = ai.determinePayloadFormat()
+	}
+	err := ai.CheckComplete()
+	if err != nil {
+		report.addError(CheckTruncated, err.Error())
+		return nil
+	}
+	return errors.New(ai.Path + " could not be opened as an AppImage")
+}
+
+// validatePayloadOffset checks that the payload starts where the ELF header says the runtime ends
+func (ai AppImage) validatePayloadOffset(report *ValidationReport) {
+	if ai.ImageType != 2 {
+		return
+	}
+	elfsize, err := helpers.CalculateElfSize(ai.Path)
+	if err != nil {
+		report.addWarning(CheckPayloadOffset, "cannot calculate the size of the runtime: "+err.Error())
+		return
+	}
+	if elfsize != ai.Offset {
+		report.addWarning(CheckPayloadOffset, "the payload does not start where the ELF header says the runtime ends")
+	}
+}
+
+// findRootDesktopFile returns the name and the contents of the desktop file in the root of the payload
+func findRootDesktopFile(payload PayloadReader) (string, []byte, error) {
+	infos, err := payload.ReadDir("")
+	if err != nil {
+		return "", nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if strings.HasSuffix(info.Name(), ".desktop") {
+			names = append(names, info.Name())
+		}
+	}
+	if len(names) != 1 {
+		return "", nil, errors.New("expected exactly one desktop file in the root of the AppImage, found " + strings.Join(names, ", "))
+	}
+	r, err := payload.Open(names[0])
+	if err != nil {
+		return names[0], nil, err
+	}
+	defer r.Close()
+	data, err := ioutil.ReadAll(r)
+	return names[0], data, err
+}
+
+func validateDesktopFile(payload PayloadReader, report *ValidationReport) *ini.File {
+	name, data, err := findRootDesktopFile(payload)
+	if err != nil {
+		report.addError(CheckDesktopFile, err.Error())
+		return nil
+	}
+	desktopReport := ValidateDesktopFile(data)
+	for _, f := range desktopReport.Errors {
+		report.addError(f.CheckID, name+": "+f.Message)
+	}
+	for _, f := range desktopReport.Warnings {
+		report.addWarning(f.CheckID, name+": "+f.Message)
+	}
+	cfg, err := ini.LoadSources(ini.LoadOptions{IgnoreInlineComment: true}, data) // Do not cripple lines hat contain ";"
+	if err != nil {
+		report.addError(CheckDesktopFile, err.Error())
+		return nil
+	}
+	return cfg
+}
+
+// validateIcon checks that the icon named in the desktop file is in the root of the payload
+func validateIcon(payload PayloadReader, desktop *ini.File, report *ValidationReport) {
+	if desktop == nil {
+		return
+	}
+	icon := desktop.Section("Desktop Entry").Key("Icon").String()
+	if icon == "" {
+		report.addError(CheckIcon, "the desktop file has no Icon= key")
+		return
+	}
+	found := false
+	for _, ext := range []string{".png", ".svg", ".svgz", ".xpm"} {
+		if _, err := payload.Stat(icon + ext); err == nil {
+			found = true
+			break
+		}
+	}
+	if !found {
+		report.addError(CheckIcon, "no icon "+icon+".png or "+icon+".svg in the root of the AppImage")
+	}
+	if _, err := payload.Stat(".DirIcon"); err != nil {
+		report.addWarning(CheckIcon, "no .DirIcon in the root of the AppImage")
+	}
+}
+
+// validateAppRun checks that AppRun exists and is executable, following symlinks inside the payload
+func validateAppRun(payload PayloadReader, report *ValidationReport) {
+	name := "AppRun"
+	for i := 0; i < 16; i++ {
+		info, err := payload.Stat(name)
+		if err != nil {
+			report.addError(CheckAppRun, "no AppRun in the root of the AppImage")
+			return
+		}
+		if info.Mode()&os.ModeSymlink == 0 {
+			if !info.Mode().IsRegular() || info.Mode().Perm()&0111 == 0 {
+				report.addError(CheckAppRun, "AppRun is not an executable file")
+			}
+			return
+		}
+		target, err := payload.Readlink(name)
+		if err != nil {
+			report.addError(CheckAppRun, err.Error())
+			return
+		}
+		if path.IsAbs(target) {
+			report.addError(CheckAppRun, "AppRun points outside of the AppImage to "+target)
+			return
+		}
+		name = path.Join(path.Dir(name), target)
+	}
+	report.addError(CheckAppRun, "too many levels of symlinks for AppRun")
+}
@@ -0,0 +1,37 @@
+package goappimage
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestValidateReportsTruncatedAppImages(t *testing.T) {
+	ai := writeSignableAppImage(t, 1)
+	info, err := os.Stat(ai.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Truncate(ai.Path, info.Size()-1); err != nil {
+		t.Fatal(err)
+	}
+	truncated := openAppImage(ai.Path)
+	report, err := truncated.Validate(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Errors) != 1 || report.Errors[0].CheckID != CheckTruncated {
+		t.Errorf("expected a %s error, got %+v", CheckTruncated, report.Errors)
+	}
+}
+
+func TestValidateRejectsOtherFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "file")
+	if err := ioutil.WriteFile(path, make([]byte, 200*1024), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := openAppImage(path).Validate(false); err == nil {
+		t.Error("expected an error for a file that is not an AppImage")
+	}
+}
@@ -0,0 +1,90 @@
+package goappimage
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+
+	"github.com/CalebQ42/GoAppImage/internal/zsync"
+)
+
+// ZsyncStats tells how much of a file downloaded with zsync was taken from the local AppImage
+// and how much had to be downloaded
+type ZsyncStats struct {
+	Reused     int64
+	Downloaded int64
+}
+
+// fetchZsyncControlFile downloads and parses the .zsync file at zsyncURL
+func fetchZsyncControlFile(client *http.Client, zsyncURL string) (*zsync.ControlFile, error) {
+	resp, err := client.Get(zsyncURL)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s: %s", zsyncURL, resp.Status)
+	}
+	return zsync.Parse(resp.Body)
+}
+
+// ZsyncDownload downloads the file described by the .zsync file at zsyncURL to destination.
+// Everything that can be found in the AppImage is taken from it, and only the missing blocks
+// are downloaded using HTTP range requests. The result is verified against the SHA-1 in the .zsync file.
+// A destination left over from an interrupted download is used as a source of blocks, too,
+// so calling ZsyncDownload again resumes it. Both are read a few blocks at a time, not into memory.
+// progress may be nil.
+func (ai AppImage) ZsyncDownload(zsyncURL string, destination string, progress ProgressFunc) (ZsyncStats, error) {
+	return ai.zsyncDownload(http.DefaultClient, zsyncURL, destination, newProgressReporter(progress))
+}
+
+func (ai AppImage) zsyncDownload(client *http.Client, zsyncURL string, destination string, p *progressReporter) (ZsyncStats, error) {
+	base, err := url.Parse(zsyncURL)
+	if err != nil {
+		return ZsyncStats{}, err
+	}
+	control, err := fetchZsyncControlFile(client, zsyncURL)
+	if err != nil {
+		return ZsyncStats{}, err
+	}
+	// The seed is searched as a whole, a block found across the boundary of both parts
+	// still has to match its checksum and is as good as any other
+	var parts []*io.SectionReader
+	for _, name := range []string{ai.Path, destination} {
+		f, err := os.Open(name)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return ZsyncStats{}, err
+		}
+		defer f.Close()
+		info, err := f.Stat()
+		if err != nil {
+			return ZsyncStats{}, err
+		}
+		parts = append(parts, io.NewSectionReader(f, 0, info.Size()))
+	}
+	seed := zsync.Concat(parts...)
+	// The interrupted download is still read through the file opened above while the new one replaces it
+	err = os.Remove(destination)
+	if err != nil && !os.IsNotExist(err) {
+		return ZsyncStats{}, err
+	}
+	out, err := os.OpenFile(destination, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0755)
+	if err != nil {
+		return ZsyncStats{}, err
+	}
+	p.enter(PhaseDownload)
+	stats, err := control.Sync(client, base, seed, seed.Size(), out, func(s zsync.Stats) {
+		p.download(s.Reused+s.Downloaded, control.Length, s.Downloaded)
+	})
+	if err != nil {
+		out.Close()
+		return ZsyncStats(stats), err
+	}
+	p.download(control.Length, control.Length, stats.Downloaded)
+	return ZsyncStats(stats), out.Close()
+}
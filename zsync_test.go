@@ -0,0 +1,79 @@
+package goappimage
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/md4"
+)
+
+// zsyncControlFile returns a .zsync file for target, with blocks of 1024 bytes
+func zsyncControlFile(target []byte) []byte {
+	const bs = 1024
+	var buf bytes.Buffer
+	sum := sha1.Sum(target)
+	fmt.Fprintf(&buf, "zsync: 0.6.2\nFilename: App.AppImage\nBlocksize: %d\nLength: %d\nHash-Lengths: 1,4,16\nURL: App.AppImage\nSHA-1: %s\n\n",
+		bs, len(target), hex.EncodeToString(sum[:]))
+	for start := 0; start < len(target); start += bs {
+		block := make([]byte, bs)
+		copy(block, target[start:])
+		var a, b uint16
+		for i, x := range block {
+			a += uint16(x)
+			b += uint16(bs-i) * uint16(x)
+		}
+		buf.Write([]byte{byte(a >> 8), byte(a), byte(b >> 8), byte(b)})
+		h := md4.New()
+		h.Write(block)
+		buf.Write(h.Sum(nil))
+	}
+	return buf.Bytes()
+}
+
+func TestZsyncDownloadResumes(t *testing.T) {
+	current := writeSignableAppImage(t, 1)
+	target := signedAppImage(t, nil, 2)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/App.AppImage.zsync":
+			w.Write(zsyncControlFile(target))
+		case "/App.AppImage":
+			http.ServeContent(w, r, "App.AppImage", time.Time{}, bytes.NewReader(target))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	// An interrupted download has the changed block already, the rest is in the AppImage
+	old, err := ioutil.ReadFile(current.Path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	changed := 0
+	for old[changed] == target[changed] {
+		changed++
+	}
+	destination := filepath.Join(t.TempDir(), "App.AppImage"+PartialSuffix)
+	if err := ioutil.WriteFile(destination, target[:changed+2048], 0644); err != nil {
+		t.Fatal(err)
+	}
+	stats, err := current.ZsyncDownload(srv.URL+"/App.AppImage.zsync", destination, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data, err := ioutil.ReadFile(destination); err != nil || !bytes.Equal(data, target) {
+		t.Errorf("the download differs: %v", err)
+	}
+	if stats.Downloaded != 0 || stats.Reused != int64(len(target)) {
+		t.Errorf("stats %+v, expected everything to be reused", stats)
+	}
+}